@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/sajjad-mobe/gdm/internal/manager"
+)
+
+const usage = `Usage:
+  gdm                               Opens the download manager.
+  gdm move <download-id> <queue-id> Moves a pending, paused or failed download to another queue.
+
+Commands change the saved downloads, run them while gdm is closed.
+`
+
+// runCommand runs a command given on the command line and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "move":
+		if len(args) != 3 {
+			break
+		}
+		downloadID, err1 := strconv.Atoi(args[1])
+		queueID, err2 := strconv.Atoi(args[2])
+		if err1 != nil || err2 != nil {
+			break
+		}
+		if err := manager.LoadData().MoveDownload(downloadID, queueID); err != nil {
+			fmt.Fprintf(os.Stderr, "Can not move download %d: %v\n", downloadID, err)
+			return 1
+		}
+		fmt.Printf("Download %d has been moved to queue %d.\n", downloadID, queueID)
+		return 0
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// bandwidthLimiter is a token bucket counted in bytes. Readers take what they
+// have read and sleep until the bucket pays off the debt, so every part of a
+// queue gets its share in the order it asked. Limits nest: a part is charged
+// on the global, queue and download limiters and waits for the longest of
+// them, so the tightest one decides its speed.
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	limit  int     // KB/s, 0 for unlimited
+	rate   float64 // bytes per second
+	burst  float64 // bytes that may pile up while idle
+	tokens float64
+	last   time.Time
+}
+
+// burstDuration is how much of a second's worth of bandwidth may be saved up
+// while a limiter is idle.
+const burstDuration = 250 * time.Millisecond
+
+func (l *bandwidthLimiter) SetLimit(bandwith int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.advance(now)
+	l.limit = max(0, bandwith)
+	l.rate = float64(l.limit) * 1024
+	l.burst = max(l.rate*burstDuration.Seconds(), 1024)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+func (l *bandwidthLimiter) Limit() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// advance adds the tokens earned since the last call.
+func (l *bandwidthLimiter) advance(now time.Time) {
+	if l.limit > 0 && !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller has
+// to wait before they are paid for.
+func (l *bandwidthLimiter) reserve(n int, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	if l.limit <= 0 {
+		return 0
+	}
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// waitBandwidth charges n bytes on every limiter and sleeps until the
+// tightest of them allows them, or until ctx is done.
+func waitBandwidth(ctx context.Context, limiters []*bandwidthLimiter, n int) error {
+	now := time.Now()
+	var delay time.Duration
+	for _, l := range limiters {
+		delay = max(delay, l.reserve(n, now))
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readSize returns how many bytes a part should read at once, small enough
+// for the tightest limit to be smooth.
+func readSize(limiters []*bandwidthLimiter) int {
+	size := maxReadSize
+	for _, l := range limiters {
+		if limit := l.Limit(); limit > 0 {
+			size = min(size, max(1024, limit*1024/8))
+		}
+	}
+	if size < maxReadSize {
+		size = min(size, 64*1024)
+	}
+	return size
+}
+
+const maxReadSize = 1024 * 1024 // 2^20 or 1 Mb
+
+// SetGlobalBandwidth limits the bandwidth of all queues together, 0 for unlimited.
+func (dm *DownloadManager) SetGlobalBandwidth(bandwith int) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.GlobalBandwidth = max(0, bandwith)
+	dm.limiter.SetLimit(dm.GlobalBandwidth)
+}
+
+// SetBandwith sets the queue's bandwidth outside of its scheduled tiers, 0 for
+// unlimited. It applies once the queue is added or through UpdateQueue.
+func (queue *Queue) SetBandwith(bandwith int) {
+	queue.MaxBandwidth = max(0, bandwith)
+}
+
+// SetBandwidthSchedule replaces the queue's bandwidth tiers. They apply once
+// the queue is added or through UpdateQueue.
+func (queue *Queue) SetBandwidthSchedule(tiers []BandwidthTier) {
+	queue.BandwidthSchedule = tiers
+}
+
+// SetBandwith limits this download on top of its queue's limit, 0 for unlimited.
+func (download *Download) SetBandwith(bandwith int) {
+	download.MaxBandwidth = max(0, bandwith)
+	if download.limiter == nil {
+		download.limiter = &bandwidthLimiter{}
+	}
+	download.limiter.SetLimit(download.MaxBandwidth)
+}
+
+// SetDownloadBandwidth limits the download on top of its queue's limit, 0 for unlimited.
+func (dm *DownloadManager) SetDownloadBandwidth(download *Download, bandwith int) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	download.SetBandwith(bandwith)
+}
+
+// limiters returns the global, queue and download limiters that apply to a download.
+func (dm *DownloadManager) limiters(download *Download) []*bandwidthLimiter {
+	return []*bandwidthLimiter{dm.limiter, download.Queue.limiter, download.limiter}
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transfer pushes total bytes through the limiters from the given number of
+// parts and returns how long it took and each part's share.
+func transfer(limiters []*bandwidthLimiter, parts, chunk, total int) (time.Duration, []int) {
+	shares := make([]int, parts)
+	var mu sync.Mutex
+	sent := 0
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < parts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if sent >= total {
+					mu.Unlock()
+					return
+				}
+				sent += chunk
+				mu.Unlock()
+				waitBandwidth(context.Background(), limiters, chunk)
+				mu.Lock()
+				shares[i] += chunk
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return time.Since(start), shares
+}
+
+// assertRate checks that total bytes took as long as the limit allows, give or
+// take 3%. At most one burst may have been saved up before the transfer.
+func assertRate(t *testing.T, total int64, elapsed time.Duration, limit int) {
+	t.Helper()
+	rate := float64(limit) * 1024
+	burst := rate * burstDuration.Seconds()
+	fastest := (float64(total) - burst) / rate * 0.97
+	slowest := float64(total) / rate * 1.03
+	if seconds := elapsed.Seconds(); seconds < fastest || seconds > slowest {
+		t.Errorf("throughput %.0f B/s, want %.0f B/s", float64(total)/seconds, rate)
+	}
+}
+
+func TestBandwidthLimiterThroughput(t *testing.T) {
+	limiter := &bandwidthLimiter{}
+	limiter.SetLimit(256)
+	elapsed, shares := transfer([]*bandwidthLimiter{limiter}, 4, 4096, 512*1024)
+	assertRate(t, 512*1024, elapsed, 256)
+	for i, share := range shares {
+		if share < 512*1024/4/2 {
+			t.Errorf("part %d got %d bytes, parts are not served fairly: %v", i, share, shares)
+		}
+	}
+}
+
+func TestBandwidthLimitersNest(t *testing.T) {
+	global, queue, download := &bandwidthLimiter{}, &bandwidthLimiter{}, &bandwidthLimiter{}
+	global.SetLimit(1024)
+	queue.SetLimit(128)
+	download.SetLimit(0)
+	elapsed, _ := transfer([]*bandwidthLimiter{global, queue, download}, 3, 2048, 192*1024)
+	assertRate(t, 192*1024, elapsed, 128)
+}
+
+func TestBandwidthLimitChangeTakesEffect(t *testing.T) {
+	limiter := &bandwidthLimiter{}
+	limiter.SetLimit(64)
+	goroutines := runtime.NumGoroutine()
+	for i := 1; i <= 100; i++ {
+		limiter.SetLimit(i)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("changing the limit started %d goroutines", n-goroutines)
+	}
+	limiter.SetLimit(512)
+	elapsed, _ := transfer([]*bandwidthLimiter{limiter}, 2, 4096, 256*1024)
+	assertRate(t, 256*1024, elapsed, 512)
+}
+
+func TestQueueBandwidthLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 384*1024)
+	server := newTestFileServer(t, content, time.Now())
+
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxBandwidth: 128, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 10*time.Second, "finished", "failed")
+
+	if dm.Status(download) != "finished" {
+		t.Fatalf("download %s", dm.Status(download))
+	}
+	assertRate(t, download.FinalSize, download.CompletedAt.Sub(download.Temps.StartTime), 128)
+}
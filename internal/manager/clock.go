@@ -0,0 +1,20 @@
+package manager
+
+import "time"
+
+// Clock tells the scheduler the time. Tests replace it to move time forward
+// without waiting.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentControl pauses, resumes, reorders and removes downloads and
+// edits their queue while they transfer and while another goroutine reads
+// them as the TUI does. Run it with -race.
+func TestConcurrentControl(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 256*1024)
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1, StartAtOneWorkerAvailable: true}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	downloads := make([]*Download, 8)
+	for i := range downloads {
+		downloads[i] = &Download{
+			ID: i + 1, QueueID: 1, Queue: queue, Status: "pending",
+			OutputFile: fmt.Sprintf("file%d.bin", i), URL: server.URL, MaxBandwidth: 128,
+		}
+		dm.AddDownload(downloads[i])
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, download := range downloads {
+				snapshot := dm.Snapshot(download)
+				_, _ = snapshot.GetProgress(), snapshot.GetSpeed()
+				dm.Position(download)
+				dm.WaitingFor(download)
+			}
+			dm.QueueSnapshot(queue)
+			dm.OpenConnections()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	for round := 0; round < 30; round++ {
+		download := downloads[1+round%(len(downloads)-1)]
+		dm.PauseDownload(download)
+		dm.ResumeDownload(download)
+		dm.SetPriority(download, Priorities[round%len(Priorities)])
+		dm.MoveDownload(download, MoveTop)
+		dm.UpdateQueue(queue, func(queue *Queue) {
+			queue.MaxConcurrentDownloads = 2 + round%3
+			queue.SetBandwith(512 * (round % 2))
+		})
+		if round%10 == 0 {
+			dm.PauseQueue(queue)
+			dm.ClearQueueState(queue)
+		}
+		if round == 15 {
+			dm.RemoveDownload(downloads[0])
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	dm.UpdateQueue(queue, func(queue *Queue) { queue.SetBandwith(0) })
+	for _, download := range downloads[1:] {
+		dm.SetDownloadBandwidth(download, 0)
+	}
+	for _, download := range downloads[1:] {
+		waitForStatus(t, dm, download, 20*time.Second, "finished")
+		snapshot := dm.Snapshot(download)
+		if snapshot.FinalSize != int64(len(content)) {
+			t.Errorf("download %d saved %d bytes, want %d", download.ID, snapshot.FinalSize, len(content))
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// connectionLimiter counts the open connections of all queues together and
+// per host. A part takes a connection before it sends its request and gives
+// it back when it is done, so the limits hold whatever queue the part is in.
+type connectionLimiter struct {
+	mu      sync.Mutex
+	limit   int // 0 for unlimited
+	perHost int // 0 for unlimited
+	open    int
+	hosts   map[string]int
+	freed   chan struct{} // closed when a connection is released or the limits change
+}
+
+// tryAcquire takes a connection to host if both limits allow it. Otherwise it
+// returns a channel that is closed when trying again may succeed.
+func (l *connectionLimiter) tryAcquire(host string) (bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit > 0 && l.open >= l.limit || l.perHost > 0 && l.hosts[host] >= l.perHost {
+		if l.freed == nil {
+			l.freed = make(chan struct{})
+		}
+		return false, l.freed
+	}
+	if l.hosts == nil {
+		l.hosts = map[string]int{}
+	}
+	l.open++
+	l.hosts[host]++
+	return true, nil
+}
+
+func (l *connectionLimiter) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.open--
+	if l.hosts[host]--; l.hosts[host] <= 0 {
+		delete(l.hosts, host)
+	}
+	l.wakeWaiting()
+}
+
+// wakeWaiting lets the parts waiting for a connection try again.
+func (l *connectionLimiter) wakeWaiting() {
+	if l.freed != nil {
+		close(l.freed)
+		l.freed = nil
+	}
+}
+
+// connectionHost returns the host a connection limit is counted for.
+func connectionHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// SetConnectionLimits caps the connections of all queues together and the
+// connections to a single host, 0 for unlimited. Connections already open
+// are kept, new ones wait until the counts are under the limits.
+func (dm *DownloadManager) SetConnectionLimits(total, perHost int) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.MaxConnections = max(0, total)
+	dm.MaxConnectionsPerHost = max(0, perHost)
+	dm.connections.mu.Lock()
+	defer dm.connections.mu.Unlock()
+	dm.connections.limit = dm.MaxConnections
+	dm.connections.perHost = dm.MaxConnectionsPerHost
+	dm.connections.wakeWaiting()
+}
+
+// OpenConnections returns the number of connections the parts hold now.
+func (dm *DownloadManager) OpenConnections() int {
+	dm.connections.mu.Lock()
+	defer dm.connections.mu.Unlock()
+	return dm.connections.open
+}
+
+// acquireConnection waits for a connection to the download's host. It gives
+// up when ctx is done, as when the download is paused while waiting.
+func (dm *DownloadManager) acquireConnection(ctx context.Context, download *Download) (release func(), ok bool) {
+	dm.mu.Lock()
+	host := connectionHost(download.URL)
+	dm.mu.Unlock()
+	for {
+		acquired, freed := dm.connections.tryAcquire(host)
+		if acquired {
+			return func() { dm.connections.release(host) }, true
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// shouldStop reports whether the parts of the download have to stop. Callers hold dm.mu.
+func (dm *DownloadManager) shouldStop(download *Download) bool {
+	return !download.Queue.IsActive || download.IsRemoved || download.Status == "paused" ||
+		download.IsPastStop(dm.Clock.Now())
+}
@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionLimits(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	var mu sync.Mutex
+	open, maxOpen := 0, 0
+	hosts, maxHosts := map[string]int{}, map[string]int{}
+	modTime := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the limits are for the parts, not the HEAD and range probes before them
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-1" {
+			host := strings.Split(r.Host, ":")[0]
+			mu.Lock()
+			open++
+			hosts[host]++
+			maxOpen = max(maxOpen, open)
+			maxHosts[host] = max(maxHosts[host], hosts[host])
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				open--
+				hosts[host]--
+				mu.Unlock()
+			}()
+			time.Sleep(200 * time.Millisecond)
+		}
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+
+	dm := newTestManager(t)
+	dm.SetConnectionLimits(3, 2)
+	var downloads []*Download
+	for q := 1; q <= 3; q++ {
+		queue := &Queue{ID: q, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1, StartAtOneWorkerAvailable: true}
+		dm.AddQueue(queue)
+		defer dm.RemoveQueue(queue)
+		for i := 0; i < 4; i++ {
+			host := "127.0.0.1"
+			if i%2 == 1 {
+				host = "localhost"
+			}
+			download := &Download{
+				ID: len(downloads) + 1, QueueID: q, Queue: queue, Status: "pending",
+				OutputFile: fmt.Sprintf("file%d.bin", i), URL: "http://" + host + port + "/file.bin",
+			}
+			dm.AddDownload(download)
+			downloads = append(downloads, download)
+		}
+	}
+	for _, download := range downloads {
+		waitForStatus(t, dm, download, 20*time.Second, "finished")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxOpen > 3 {
+		t.Errorf("%d connections were open at once, the limit is 3", maxOpen)
+	}
+	for host, n := range maxHosts {
+		if n > 2 {
+			t.Errorf("%d connections to %s were open at once, the limit is 2", n, host)
+		}
+	}
+	if maxOpen < 2 {
+		t.Errorf("at most %d connection was open, the downloads did not run in parallel", maxOpen)
+	}
+	if n := dm.OpenConnections(); n != 0 {
+		t.Errorf("%d connections are still counted after all downloads finished", n)
+	}
+}
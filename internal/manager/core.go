@@ -1,6 +1,8 @@
 package manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -21,122 +23,183 @@ func NewManager(maxParts, partSize int) *DownloadManager {
 	if err := os.MkdirAll(TempFolder, os.ModePerm); err != nil {
 		log.Fatal("Failed to create temp directory:", err)
 	}
-	return &DownloadManager{Queues: []*Queue{}, MaxParts: maxParts, PartSize: partSize, TempFolder: TempFolder}
+	ctx, shutdown := context.WithCancel(context.Background())
+	return &DownloadManager{
+		Clock:       realClock{},
+		Queues:      []*Queue{},
+		MaxParts:    maxParts,
+		PartSize:    partSize,
+		TempFolder:  TempFolder,
+		limiter:     &bandwidthLimiter{},
+		connections: &connectionLimiter{},
+		Timeouts:    DefaultTimeouts,
+		transport:   newTransport(DefaultTimeouts, DefaultIdleConnsPerHost),
+		probes:      map[string]hostProbe{},
+		ctx:         ctx,
+		shutdown:    shutdown,
+
+		IdleConnsPerHost:   DefaultIdleConnsPerHost,
+		RecurringDownloads: make(chan *Download, 16),
+	}
+}
+
+// Shutdown stops the schedulers and every transfer, waits until the parts
+// closed their files and saves the store given to UseStore. Downloads it
+// stopped are pending again at the next start and go on from their parts.
+// It returns ctx's error when the parts do not stop in time, and saves anyway.
+func (dm *DownloadManager) Shutdown(ctx context.Context) error {
+	dm.mu.Lock()
+	dm.shutdown()
+	dm.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		dm.running.Wait()
+		close(stopped)
+	}()
+	var err error
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if dm.store != nil {
+		if saveErr := dm.store.Save(); err == nil {
+			err = saveErr
+		}
+	}
+	return err
 }
 
 func (dm *DownloadManager) AddQueue(queue *Queue) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	queue.IsActive = false
 	queue.IsRemoved = false
-	queue.PartDownloaders = make(chan *PartDownloader, queue.MaxConcurrentDownloads)
+	queue.wake = make(chan struct{}, 1)
+	queue.workers = newWorkerPool(max(1, queue.MaxConcurrentDownloads), func() { dm.notify(queue) })
 	dm.Queues = append(dm.Queues, queue)
-	if queue.MaxBandwidth > 0 {
-		queue.SetBandwith(queue.MaxBandwidth)
-	}
-	go func() {
-		for {
-			if queue.IsRemoved {
-				return
-			}
-			if IsWithinActiveHours(queue.ActiveStartTime, queue.ActiveEndTime) {
-				queue.IsActive = true
-				for _, download := range queue.Downloads {
-
-					for {
-						if download.Status != "initializing" {
-							break
-						}
-						time.Sleep(time.Millisecond * 500)
-					}
-
-					if download.Status != "pending" {
-						continue
-					}
-					// queueMutex.Lock()
-					if !queue.StartAtOneWorkerAvailable {
-						// fmt.Println("wait for worker")
-						for {
-							freeDownloaders := queue.MaxConcurrentDownloads - len(queue.PartDownloaders)
-							if freeDownloaders >= len(download.PartDownloaders) {
-								break
-							}
-							time.Sleep(time.Millisecond * 500)
-						}
-					}
-					// queueMutex.Unlock()
-					var StartWG sync.WaitGroup
-					StartWG.Add(len(download.PartDownloaders))
-					dm.startDownload(download, &StartWG)
-					StartWG.Wait()
-
-				}
-			} else {
-				//TODO
-				//fmt.Println("queue ", queue.ID, " not working!")
-				queue.IsActive = false
-			}
-			// fmt.Printf("\n%s", progress)
-			time.Sleep(1 * time.Second)
+	queue.SetBandwith(queue.MaxBandwidth)
+	queue.applyBandwidth(dm.Clock.Now())
+	go dm.followBandwidthSchedule(queue)
+	go dm.runScheduler(queue)
+}
+
+// followBandwidthSchedule switches the queue's limit when a tier starts or
+// ends. Running parts keep going and pick up the new limit on their next read.
+func (dm *DownloadManager) followBandwidthSchedule(queue *Queue) {
+	for {
+		dm.mu.Lock()
+		if queue.IsRemoved || dm.ctx.Err() != nil {
+			dm.mu.Unlock()
+			return
 		}
-	}()
+		now := dm.Clock.Now()
+		queue.applyBandwidth(now)
+		dm.mu.Unlock()
+		select {
+		case <-dm.Clock.After(untilNextMinute(now)):
+		case <-dm.ctx.Done():
+		}
+	}
 }
 
 func (dm *DownloadManager) AddDownload(download *Download) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	if download.Status == "finished" {
+		// nothing left to download, kept for the downloads that depend on it
+		download.Temps = &DownloadTemps{}
+		download.Queue.Downloads = append(download.Queue.Downloads, download)
 		return
 	}
-	download.Temps = &DownloadTemps{0, 0, time.Now(), &sync.Mutex{}}
+	download.Temps = &DownloadTemps{StartTime: time.Now()}
 	download.IsActive = false
 	download.IsRemoved = false
+	download.SetBandwith(download.MaxBandwidth)
 
 	if download.Status != "failed" && download.Status != "paused" {
 		download.Status = "initializing"
 	}
+	if download.Order == 0 {
+		download.Order = download.Queue.nextOrder()
+	}
 	download.Queue.Downloads = append(download.Queue.Downloads, download)
 	go dm.initializeDownload(download)
 
 }
+
 func (dm *DownloadManager) initializeDownload(download *Download) {
-	download.Temps.TotalDownloaded = 0
-	if download.TotalSize < 1 {
-		resp, err := http.Head(download.URL)
-		if err != nil {
-			// fmt.Println("Error:", err)
-			download.Status = "failed"
-			return
+	dm.mu.Lock()
+	rawURL, known, client := download.URL, download.TotalSize > 0, dm.client()
+	dm.mu.Unlock()
+	var remote *remoteFile
+	var err error
+	for !known {
+		if remote, err = dm.probeURL(dm.ctx, client, rawURL); err == nil {
+			break
 		}
-		if resp.StatusCode != http.StatusOK {
-			download.Status = "failed"
-			// fmt.Println("Failed to fetch file details:", resp.Status)
-			return
+		dm.mu.Lock()
+		delay, retry := dm.nextRetry(download, &download.Temps.Retries, err)
+		retry = retry && download.Status == "initializing" && !download.IsRemoved && dm.ctx.Err() == nil
+		dm.mu.Unlock()
+		if !retry {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-dm.ctx.Done():
 		}
-		download.TotalSize = resp.ContentLength
-		resp.Body.Close()
+	}
 
-		req, _ := http.NewRequest("GET", download.URL, nil)
-		client := &http.Client{}
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", 0, 1))
-		resp, err = client.Do(req)
-		if err != nil {
-			download.Status = "failed"
-			// fmt.Println("Error:", err)
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	defer dm.notifyAll() // it may start now, or unblock the downloads waiting for it
+	if download.IsRemoved || dm.ctx.Err() != nil {
+		return // initialized again at the next start
+	}
+	download.Temps.TotalDownloaded = 0
+	if err != nil {
+		if download.Status == "initializing" { // a paused download stays paused
+			dm.fail(download, err)
+		}
+		return
+	}
+	if remote != nil {
+		download.TotalSize = remote.size
+		download.LastModified = remote.lastModified
+		if download.OutputFile == "" {
+			download.OutputFile = remote.fileName
+		}
+		download.IsPartial = remote.partial
+	}
+	download.Temps.ResumeOffset = 0
+	fullPath := filepath.Join(download.Queue.SaveDir, download.OutputFile)
+	if download.GetConflictPolicy() == ConflictSkip && download.TotalSize > 0 && getFileSize(fullPath) == download.TotalSize {
+		// taken as the same file without downloading it, the content is
+		// compared with the parts only when the server gives no size
+		keepExisting(download, fullPath)
+		return
+	}
+	if download.IsPartial && download.GetConflictPolicy() == ConflictResume {
+		existing := getFileSize(fullPath)
+		if existing == download.TotalSize {
+			keepExisting(download, fullPath) // already complete
 			return
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusPartialContent {
-			download.IsPartial = false
-			download.TotalSize = 0
-		} else {
-			download.IsPartial = true
-			// fmt.Println(download.Temps.TotalSize)
+		if existing < download.TotalSize {
+			download.Temps.ResumeOffset = existing
+			download.Temps.TotalDownloaded = existing
 		}
 	}
 	if download.IsPartial {
-		numParts := min(dm.MaxParts, max(1, int(download.TotalSize/(int64(dm.PartSize)*1024*1024)))) // each partSize mb add to new part
-		partSize := download.TotalSize / int64(numParts)
+		remaining := download.TotalSize - download.Temps.ResumeOffset
+		numParts := min(dm.MaxParts, max(1, int(remaining/(int64(dm.PartSize)*1024*1024)))) // each partSize mb add to new part
+		partSize := remaining / int64(numParts)
 		var PartDownloaders []*PartDownloader
 		download.PartDownloaders = PartDownloaders
 		for i := 0; i < numParts; i++ {
-			start := partSize * int64(i)
+			start := download.Temps.ResumeOffset + partSize*int64(i)
 			end := start + partSize - 1
 			if i == numParts-1 {
 				end = download.TotalSize - 1
@@ -154,7 +217,7 @@ func (dm *DownloadManager) initializeDownload(download *Download) {
 
 		}
 	} else {
-		download.PartDownloaders = append(download.PartDownloaders, &PartDownloader{
+		download.PartDownloaders = []*PartDownloader{{
 			Index: 0,
 			Start: 0,
 			End:   0,
@@ -165,96 +228,194 @@ func (dm *DownloadManager) initializeDownload(download *Download) {
 					0,
 				),
 			),
-		})
+		}}
 	}
+	download.Temps.InitialSize = download.Temps.TotalDownloaded
 	if download.Status == "initializing" {
 		download.Status = "pending"
 	}
 }
 
 func (dm *DownloadManager) PauseDownload(download *Download) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	download.PausedByQueue = false // paused by the user, stays paused
 	download.Status = "paused"
+	dm.stopParts(download)
+}
+
+// stopParts cancels the running parts of the download, even in the middle of
+// a read. Callers hold dm.mu.
+func (dm *DownloadManager) stopParts(download *Download) {
+	if download.Temps != nil && download.Temps.stop != nil {
+		download.Temps.stop()
+	}
 }
 
 func (dm *DownloadManager) ResumeDownload(download *Download) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.resumeDownload(download)
+}
+
+// resumeDownload initializes the download again, once its parts stopped if
+// it was paused a moment ago. Callers hold dm.mu.
+func (dm *DownloadManager) resumeDownload(download *Download) {
+	if download.Temps.stop != nil {
+		download.Temps.ResumeAfterStop = true
+		return
+	}
+	if download.IsPastStop(dm.Clock.Now()) {
+		download.StopAt = time.Time{} // the deadline is over, resume for good
+	}
+	if download.ErrorKind == ErrorDiskFull {
+		download.LastError, download.ErrorKind = "", "" // checked again before it starts
+	}
 	download.Status = "initializing"
 	go dm.initializeDownload(download)
 }
 
 func (dm *DownloadManager) RetryDownload(download *Download) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.retryDownload(download)
+}
+
+// retryDownload probes and initializes the download again. Callers hold dm.mu.
+func (dm *DownloadManager) retryDownload(download *Download) {
+	if download.ErrorKind == ErrorRemoteChanged {
+		dm.forgetRemote(download)
+	}
 	download.Status = "initializing"
 	download.Temps.Retries = 0
+	download.LastError, download.ErrorKind = "", ""
 	go dm.initializeDownload(download)
 }
 
+// RetryParts runs the given failed parts of a failed download again with
+// their retries counted from zero, keeping what the other parts downloaded.
+func (dm *DownloadManager) RetryParts(download *Download, indexes ...int) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if download.Status != "failed" {
+		return errors.New("the download did not fail")
+	}
+	if download.ErrorKind == ErrorRemoteChanged {
+		dm.retryDownload(download) // the parts that did not fail are of the old file as well
+		return nil
+	}
+	for _, index := range indexes {
+		if index < 0 || index >= len(download.PartDownloaders) || !download.PartDownloaders[index].IsFailed {
+			return fmt.Errorf("part %d did not fail", index)
+		}
+	}
+	for _, index := range indexes {
+		part := download.PartDownloaders[index]
+		part.IsFailed, part.Err, part.Retries = false, nil, 0
+	}
+	for _, part := range download.PartDownloaders {
+		part.IsPaused = false
+	}
+	download.Status = "pending" // its parts are ready, the queue starts it
+	download.LastError, download.ErrorKind = "", ""
+	dm.notify(download.Queue)
+	return nil
+}
+
+// forgetRemote drops what is known and downloaded of a file that changed on
+// the server, so that it is probed and downloaded again from its start.
+// Callers hold dm.mu.
+func (dm *DownloadManager) forgetRemote(download *Download) {
+	removeParts(download)
+	download.PartDownloaders = nil
+	download.TotalSize, download.LastModified, download.IsPartial = 0, "", false
+}
+
 func (dm *DownloadManager) RemoveDownload(download *Download) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.removeDownload(download)
+	dm.notifyAll()
+}
+
+// removeDownload stops the download and deletes its parts. Callers hold dm.mu.
+func (dm *DownloadManager) removeDownload(download *Download) {
 	download.Status = "paused"
 	download.IsRemoved = true
 	if !download.Queue.IsRemoved {
-
-		var updatedDownloads []*Download
-		for _, d := range download.Queue.Downloads {
-			if d.ID != download.ID {
-				updatedDownloads = append(updatedDownloads, d)
-			}
-		}
-		download.Queue.Downloads = updatedDownloads
+		download.Queue.removeDownload(download)
 	}
-	go func() {
-		time.Sleep(time.Second) // ensure download is paused
-		for _, pd := range download.PartDownloaders {
-			os.Remove(pd.TempFile)
-		}
-	}()
-
+	dm.forgetDependency(download)
+	if download.Temps != nil && download.Temps.stop != nil {
+		download.Temps.stop() // its parts are deleted once they stopped
+		return
+	}
+	removeParts(download)
 }
 func (dm *DownloadManager) RemoveQueue(queue *Queue) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 
 	queue.IsActive = false
 	queue.IsRemoved = true
+	dm.forgetQueueDependency(queue)
 
 	for _, d := range queue.Downloads {
-		dm.RemoveDownload(d)
+		dm.removeDownload(d)
 	}
+	dm.notifyAll() // its scheduler stops
 }
 
-func (dm *DownloadManager) startDownload(download *Download, StartWG *sync.WaitGroup) {
+// startDownload hands the parts of the download to the workers of its queue.
+// Callers hold dm.mu.
+func (dm *DownloadManager) startDownload(download *Download) {
+	ctx, stop := context.WithCancel(dm.ctx)
+	download.Temps.StartTime = time.Now()
+	download.Temps.stop = stop
+	download.Status = "downloading"
+	dm.running.Add(1)
 
 	var wg sync.WaitGroup
-	// fmt.Println("downloading " + download.URL)
-	for id, part := range download.PartDownloaders {
+	for _, part := range download.PartDownloaders {
+		if part.IsFailed {
+			continue // runs again once it is retried with RetryParts
+		}
 		wg.Add(1)
-		go func() {
+		download.Queue.workers.submit(func() {
 			defer wg.Done()
-			download.Queue.PartDownloaders <- part
-			if id == 0 {
-				download.Temps.StartTime = time.Now()
-				download.Status = "downloading"
-
+			dm.mu.Lock()
+			stopped := ctx.Err() != nil || dm.shouldStop(download)
+			if stopped { // paused while it waited for a worker
+				part.IsPaused = true
 			}
-			StartWG.Done()
-			// fmt.Println("part", part.Index, "started")
-			err := dm.partDownload(download, part)
-			if err != nil {
-				// fmt.Println(err)
-				part.IsFailed = true
-				<-download.Queue.PartDownloaders
+			dm.mu.Unlock()
+			if stopped {
 				return
 			}
-			part.IsFailed = false
-			// time.Sleep(5 * time.Second)
-			// fmt.Println("end of ", download.URL)
-			<-download.Queue.PartDownloaders
-
-		}()
+			err := dm.partDownload(ctx, download, part)
+			dm.mu.Lock()
+			part.IsFailed, part.Err = err != nil, err
+			dm.mu.Unlock()
+		})
 	}
-	// time.Sleep(time.Second * 10)
-	// close(download.IsCompletlyStarted)
 
 	go func() {
+		defer dm.running.Done()
 		wg.Wait()
+		dm.mu.Lock()
+		defer dm.mu.Unlock()
+		defer dm.notifyAll()
+		stop()
+		download.Temps.stop = nil
+		if download.IsRemoved {
+			removeParts(download)
+			return
+		}
+		resume := download.Temps.ResumeAfterStop
+		download.Temps.ResumeAfterStop = false
 		IsDone := true
 		IsPaused := false
+		var failed error
 		for _, part := range download.PartDownloaders {
 			part.Speed = 0
 			if part.IsPaused {
@@ -264,135 +425,261 @@ func (dm *DownloadManager) startDownload(download *Download, StartWG *sync.WaitG
 			}
 			if part.IsFailed {
 				IsDone = false
+				failed = part.Err
 				break
 			}
 		}
+		if failed != nil {
+			dm.fail(download, failed)
+		}
 		if IsDone {
-			download.Status = "finished"
 			// fmt.Println(download.URL, "finished")
-			mergeParts(download)
+			dm.merge(download, download.GetConflictPolicy())
 		}
 		if IsPaused {
+			if download.Status == "downloading" && dm.ctx.Err() != nil {
+				download.Status = "pending" // stopped by Shutdown, it goes on at the next start
+				return
+			}
+			if download.Status == "downloading" && !download.Queue.IsActive {
+				download.PausedByQueue = true
+			}
 			download.Status = "paused"
+			if resume && !download.IsRemoved {
+				dm.resumeDownload(download)
+			}
 		}
 	}()
 }
 
-func (dm *DownloadManager) partDownload(download *Download, partDownloader *PartDownloader) error {
+// merge puts the parts together into the saved file without holding dm.mu,
+// which callers hold, while it copies them.
+func (dm *DownloadManager) merge(download *Download, policy string) {
+	download.Status = "merging"
+	merged := download.snapshot()
+	dm.mu.Unlock()
+	err := mergePartsWithPolicy(merged, policy)
+	dm.mu.Lock()
+	download.OutputPath = merged.OutputPath
+	dm.finishDownload(download, err)
+}
+
+// finishDownload sets the status the merge ended in. Callers hold dm.mu.
+func (dm *DownloadManager) finishDownload(download *Download, mergeErr error) {
+	switch {
+	case mergeErr == errFileConflict:
+		download.Status = "conflict"
+	case mergeErr != nil && classifyError(mergeErr).Kind == ErrorDiskFull:
+		dm.pauseForSpace(download, mergeErr) // merged again from the parts once resumed
+	case mergeErr != nil:
+		dm.fail(download, mergeErr)
+	default:
+		recordCompletion(download)
+		download.Status = "finished"
+		download.LastError, download.ErrorKind = "", ""
+	}
+}
+
+// keepExisting finishes the download with the file already saved at fullPath.
+func keepExisting(download *Download, fullPath string) {
+	download.OutputPath = fullPath
+	recordCompletion(download)
+	download.Status = "finished"
+	download.LastError, download.ErrorKind = "", ""
+}
+
+// recordCompletion stores where and when the file was saved, and its size when
+// the server did not tell it, and keeps the server's modification time on it.
+func recordCompletion(download *Download) {
+	download.CompletedAt = time.Now()
+	download.FinalSize = getFileSize(download.OutputPath)
+	if download.TotalSize <= 0 {
+		download.TotalSize = download.FinalSize // the server did not tell
+	}
+	if download.Temps != nil {
+		elapsed := download.CompletedAt.Sub(download.Temps.StartTime).Seconds()
+		if elapsed > 0 {
+			download.AverageSpeed = int64(float64(download.Temps.TotalDownloaded-download.Temps.InitialSize) / elapsed)
+		}
+	}
+	if lastModified, err := http.ParseTime(download.LastModified); err == nil {
+		os.Chtimes(download.OutputPath, time.Now(), lastModified)
+	}
+}
+
+// ResolveConflict saves a download that is waiting in the "conflict" status
+// using the given conflict policy.
+func (dm *DownloadManager) ResolveConflict(download *Download, policy string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if download.Status != "conflict" || policy == ConflictAsk || dm.ctx.Err() != nil {
+		return
+	}
+	download.Status = "merging"
+	dm.running.Add(1)
+	go func() {
+		defer dm.running.Done()
+		dm.mu.Lock()
+		defer dm.mu.Unlock()
+		dm.merge(download, policy)
+		dm.notifyAll()
+	}()
+}
+
+// sameTotal reports whether the Content-Range of a partial response gives
+// the size the download expects, when it gives one at all.
+func sameTotal(resp *http.Response, totalSize int64) bool {
+	total := contentRangeTotal(resp)
+	return total == 0 || totalSize <= 0 || total == totalSize
+}
+
+// partDownload downloads one part until it is complete or ctx is done, in
+// which case the part is paused. After a transient error it waits as the
+// queue's retry policy says and goes on from where the part stopped.
+func (dm *DownloadManager) partDownload(ctx context.Context, download *Download, partDownloader *PartDownloader) error {
+	for {
+		err := dm.partAttempt(ctx, download, partDownloader)
+		if err == nil {
+			return nil
+		}
+		dm.mu.Lock()
+		if classifyError(err).Kind == ErrorDiskFull {
+			// the other parts write to the same disk, they stop as well
+			partDownloader.IsPaused = true
+			dm.pauseForSpace(download, err)
+			dm.mu.Unlock()
+			return nil
+		}
+		delay, retry := dm.nextRetry(download, &partDownloader.Retries, err)
+		dm.mu.Unlock()
+		if !retry {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			dm.mu.Lock()
+			partDownloader.IsPaused = true
+			dm.mu.Unlock()
+			return nil
+		}
+	}
+}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", download.URL, nil)
+// partAttempt makes one request for the rest of the part and writes what it
+// receives until the part is complete, stopped or the request fails.
+func (dm *DownloadManager) partAttempt(ctx context.Context, download *Download, partDownloader *PartDownloader) error {
+	dm.mu.Lock()
+	rawURL, isPartial, lastModified, totalSize := download.URL, download.IsPartial, download.LastModified, download.TotalSize
+	start, end, tempFile := partDownloader.Start, partDownloader.End, partDownloader.TempFile
+	limiters := dm.limiters(download)
+	client, timeouts := dm.client(), dm.Timeouts
+	dm.mu.Unlock()
+
+	// canceled with errStalled when the body stops coming
+	reqCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	req, err := http.NewRequestWithContext(reqCtx, "GET", rawURL, nil)
 	if err != nil {
 		return err
 	}
 
-	if partDownloader.Start < partDownloader.End {
-		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", partDownloader.Start, partDownloader.End))
-	} else if download.IsPartial {
+	if isPartial {
+		if start > end {
+			return nil // complete
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+		if lastModified != "" {
+			req.Header.Set("If-Range", lastModified) // the whole file comes back if it changed
+		}
+	}
+
+	paused := func() error {
+		dm.mu.Lock()
+		partDownloader.IsPaused = true
+		dm.mu.Unlock()
 		return nil
 	}
+	release, ok := dm.acquireConnection(ctx, download)
+	if !ok {
+		return paused()
+	}
+	defer release()
 
 	resp, err := client.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return paused()
+		}
 		return err
 	}
 
 	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 400:
+		discardBody(resp)
+		return httpError(resp)
+	case isPartial && (resp.StatusCode != http.StatusPartialContent || !sameTotal(resp, totalSize)):
+		return &DownloadError{Kind: ErrorRemoteChanged}
+	}
 
-	file, err := os.OpenFile(
-		partDownloader.TempFile,
-		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	// file, err := os.Create(partDownloader.TempFile)
-
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !isPartial {
+		// without ranges the file comes from its start again
+		flags |= os.O_TRUNC
+		dm.mu.Lock()
+		download.Temps.TotalDownloaded -= partDownloader.Downloaded
+		partDownloader.Downloaded = 0
+		dm.mu.Unlock()
+	}
+	file, err := os.OpenFile(tempFile, flags, 0666)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	var buf []byte
-	bandwidth := download.Queue.MaxBandwidth
-	if bandwidth > 0 {
-		buf = make([]byte, 1024) // 2^10 or 1 Kb
-	} else {
-		buf = make([]byte, 1024*1024) // 2^20 or 1 Mb
-	}
+	buf := make([]byte, maxReadSize)
+	watch := newStallWatch(timeouts, cancel)
+	defer watch.stop()
 
 	for {
-		if download.Queue.MaxBandwidth != bandwidth {
-			time.Sleep(1 * time.Second)
-			bandwidth := download.Queue.MaxBandwidth // get new bandwith
-			if bandwidth > 0 {
-				buf = make([]byte, 1024) // 2^10 or 1 Kb
-			} else {
-				buf = make([]byte, 1024*1024) // 2^20 or 1 Mb
-			}
-		}
 		startTime := time.Now()
-		if bandwidth > 0 {
-			// fmt.Println(download.Queue.MaxBandwidth)
-			<-download.Queue.tokenBucket
-		}
-		n, err := resp.Body.Read(buf)
+		n, err := watch.read(func() (int, error) { return resp.Body.Read(buf[:readSize(limiters)]) })
+		var writeErr error
 		if n > 0 {
-			// limiter.WaitN(context.Background(), n)
-
-			partDownloader.Downloaded += int64(n)
-			download.Temps.Mutex.Lock()
-			download.Temps.TotalDownloaded += int64(n)
-			download.Temps.Mutex.Unlock()
-			file.Write(buf[:n])
+			waitBandwidth(ctx, limiters, n) // the bytes read are kept even when it is stopped meanwhile
+			// n becomes what reached the temp file, the next attempt goes on after it
+			n, writeErr = file.Write(buf[:n])
 		}
 		elapsed := time.Since(startTime).Seconds()
-		partDownloader.Speed = int64(float64(n) / elapsed)
 
+		dm.mu.Lock()
+		partDownloader.Start += int64(n)
+		partDownloader.Downloaded += int64(n)
+		download.Temps.TotalDownloaded += int64(n)
+		partDownloader.Speed = int64(float64(n) / elapsed)
+		if writeErr != nil {
+			dm.mu.Unlock()
+			return writeErr
+		}
 		if err == io.EOF {
-			break
+			dm.mu.Unlock()
+			return nil
 		}
-		if !download.Queue.IsActive || download.IsRemoved || download.Status == "paused" {
+		if ctx.Err() != nil || dm.shouldStop(download) {
 			partDownloader.IsPaused = true
-			break
+			dm.mu.Unlock()
+			return nil
+		}
+		dm.mu.Unlock()
+		if err != nil && context.Cause(reqCtx) == errStalled {
+			return &DownloadError{Kind: ErrorStalled, Detail: fmt.Sprintf("no data for %s", timeouts.IdleRead)}
 		}
 		if err != nil {
-			download.Temps.Mutex.Lock()
-			download.Temps.Retries++
-			download.Temps.Mutex.Unlock()
-
-			if download.Temps.Retries > download.Queue.MaxRetries {
-				partDownloader.IsFailed = true
-				return err
-			}
-			time.Sleep(2 * time.Second)
+			return err
 		}
-		if download.Temps.Retries > download.Queue.MaxRetries {
-			return nil
+		if err := watch.stalled(); err != nil {
+			return err
 		}
 	}
-
-	return nil
-}
-
-func (queue *Queue) SetBandwith(bandwith int) {
-	queue.MaxBandwidth = 0
-	if queue.ticker != nil {
-		queue.ticker.Stop()
-	}
-	queue.tokenBucket = make(chan struct{}, bandwith)
-	go func() {
-		var tokenInterval int
-		if bandwith == 0 {
-			tokenInterval = 1000_000
-		} else {
-			tokenInterval = max(1, 1000_000/bandwith)
-		}
-		queue.ticker = time.NewTicker(time.Duration(tokenInterval) * time.Microsecond)
-		queue.MaxBandwidth = bandwith
-
-		defer queue.ticker.Stop()
-		for range queue.ticker.C {
-			select {
-			case queue.tokenBucket <- struct{}{}:
-			default:
-			}
-		}
-	}()
 }
@@ -0,0 +1,69 @@
+//go:build linux || darwin || freebsd
+
+package manager
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPartialWriteResumes(t *testing.T) {
+	content := make([]byte, 2*1024*1024+512*1024)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	// the temp files cannot grow past an odd size, so the write that
+	// reaches it is cut short with EFBIG
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_FSIZE, &limit); err != nil {
+		t.Skip(err)
+	}
+	small := limit
+	small.Cur = 300007
+	if err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &small); err != nil {
+		t.Skip(err)
+	}
+	restore := func() { syscall.Setrlimit(syscall.RLIMIT_FSIZE, &limit) }
+	defer restore()
+
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "failed", "finished")
+	restore()
+	snapshot := dm.Snapshot(download)
+	if snapshot.Status != "failed" {
+		t.Fatalf("the download is %s past the file size limit", snapshot.Status)
+	}
+	for _, part := range snapshot.PartDownloaders {
+		if size := getFileSize(part.TempFile); size != part.Downloaded {
+			t.Errorf("part %d has %d bytes in its temp file, %d counted", part.Index+1, size, part.Downloaded)
+		}
+	}
+
+	var failed []int
+	for _, part := range snapshot.PartDownloaders {
+		if part.IsFailed {
+			failed = append(failed, part.Index)
+		}
+	}
+	if err := dm.RetryParts(download, failed...); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+	snapshot = dm.Snapshot(download)
+	if snapshot.Status != "finished" {
+		t.Fatalf("the retried download is %s: %s", snapshot.Status, snapshot.LastError)
+	}
+	if saved, err := os.ReadFile(snapshot.OutputPath); err != nil || !bytes.Equal(saved, content) {
+		t.Errorf("the saved file differs from the served one: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package manager
+
+import "testing"
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr, after, want string
+	}{
+		{"30 2 * * *", "2026-10-19 08:00", "2026-10-20 02:30"},
+		{"@daily", "2026-10-19 00:00", "2026-10-20 00:00"},
+		{"*/15 9-17 * * mon-fri", "2026-10-19 17:50", "2026-10-20 09:00"},
+		{"0 12 * * 7", "2026-10-19 08:00", "2026-10-25 12:00"},   // 7 is Sunday
+		{"0 0 1 * mon", "2026-10-19 08:00", "2026-10-26 00:00"},  // either day field matches
+		{"0 6 29 feb *", "2026-10-19 08:00", "2028-02-29 06:00"}, // next leap day
+		{"5/20 * * * *", "2026-10-19 08:46", "2026-10-19 09:05"}, // from 5 to the end
+		{"0 0 1 jan,jul *", "2026-10-19 08:00", "2027-01-01 00:00"},
+		{"0 0 30 2 *", "2026-10-19 08:00", ""}, // never
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", test.expr, err)
+		}
+		next := schedule.Next(mustTime(t, test.after, "UTC"))
+		if test.want == "" {
+			if !next.IsZero() {
+				t.Errorf("%q after %s = %v, want never", test.expr, test.after, next)
+			}
+			continue
+		}
+		if want := mustTime(t, test.want, "UTC"); !next.Equal(want) {
+			t.Errorf("%q after %s = %v, want %v", test.expr, test.after, next, want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) accepted an invalid expression", expr)
+		}
+	}
+}
@@ -20,8 +20,10 @@ func LoadData() *DataStore {
 	file, err := os.Open(getDBPath())
 	if err != nil {
 		return &DataStore{
-			Queues:    make(map[string]*Queue),
-			Downloads: make(map[string]*Download),
+			Queues:     make(map[string]*Queue),
+			Downloads:  make(map[string]*Download),
+			Settings:   &Settings{},
+			Recurrings: make(map[string]*Recurring),
 		}
 	}
 	defer file.Close()
@@ -30,8 +32,10 @@ func LoadData() *DataStore {
 	var data DataStore
 	if err := json.NewDecoder(file).Decode(&data); err != nil {
 		return &DataStore{
-			Queues:    make(map[string]*Queue),
-			Downloads: make(map[string]*Download),
+			Queues:     make(map[string]*Queue),
+			Downloads:  make(map[string]*Download),
+			Settings:   &Settings{},
+			Recurrings: make(map[string]*Recurring),
 		}
 	}
 
@@ -42,6 +46,12 @@ func LoadData() *DataStore {
 	if data.Downloads == nil {
 		data.Downloads = make(map[string]*Download)
 	}
+	if data.Settings == nil {
+		data.Settings = &Settings{}
+	}
+	if data.Recurrings == nil {
+		data.Recurrings = make(map[string]*Recurring)
+	}
 
 	return &data
 }
@@ -63,8 +73,19 @@ func getDBPath() string {
 	return filepath.Join(appConfigDir, "database.json")
 }
 
+// UseStore makes Save hold the manager's lock while it writes the downloads
+// and queues the manager is working on, and Shutdown save the store.
+func (dm *DownloadManager) UseStore(data *DataStore) {
+	data.manager = dm
+	dm.store = data
+}
+
 // SaveData writes the DataStore back to the JSON file
 func (data *DataStore) Save() error {
+	if data.manager != nil {
+		data.manager.mu.Lock()
+		defer data.manager.mu.Unlock()
+	}
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -102,6 +123,18 @@ func (data *DataStore) RemoveDownload(download *Download) {
 	delete(data.Downloads, strconv.Itoa(download.ID))
 }
 
+// AddRecurring adds a new Recurring download to the DataStore
+func (data *DataStore) AddRecurring(recurring *Recurring) {
+	data.Recurrings[strconv.Itoa(recurring.ID)] = recurring
+	data.Save()
+}
+
+// RemoveRecurring removes a Recurring download from the DataStore
+func (data *DataStore) RemoveRecurring(recurring *Recurring) {
+	delete(data.Recurrings, strconv.Itoa(recurring.ID))
+	data.Save()
+}
+
 func ResetAll(tempDir string) error {
 	return filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Dependency policies, applied when a download the download depends on failed.
+const (
+	DependencyBlock   = "block"   // wait until the failed download is retried and finishes
+	DependencyCascade = "cascade" // fail as well
+	DependencyIgnore  = "ignore"  // start anyway, a failed download counts as done
+)
+
+var DependencyPolicies = []string{DependencyBlock, DependencyCascade, DependencyIgnore}
+
+// GetDependencyPolicy returns the download's dependency policy, block when it has none.
+func (d *Download) GetDependencyPolicy() string {
+	if d.DependencyPolicy == "" {
+		return DependencyBlock
+	}
+	return d.DependencyPolicy
+}
+
+// findDownload returns the download with the given ID in any queue, or nil.
+func (dm *DownloadManager) findDownload(id int) *Download {
+	for _, queue := range dm.Queues {
+		for _, download := range queue.Downloads {
+			if download.ID == id && !download.IsRemoved {
+				return download
+			}
+		}
+	}
+	return nil
+}
+
+func (dm *DownloadManager) findQueue(id int) *Queue {
+	for _, queue := range dm.Queues {
+		if queue.ID == id && !queue.IsRemoved {
+			return queue
+		}
+	}
+	return nil
+}
+
+// WaitingFor returns the IDs of the downloads the download still waits for.
+func (dm *DownloadManager) WaitingFor(download *Download) []int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.waitingFor(download)
+}
+
+// waitingFor leaves out the dependencies the manager does not know, such as
+// removed downloads, see MissingDependencies.
+func (dm *DownloadManager) waitingFor(download *Download) []int {
+	var waiting []int
+	for _, id := range download.DependsOn {
+		dependency := dm.findDownload(id)
+		if dependency == nil || dependency.Status == "finished" ||
+			dependency.Status == "failed" && download.GetDependencyPolicy() == DependencyIgnore {
+			continue
+		}
+		waiting = append(waiting, id)
+	}
+	return waiting
+}
+
+// MissingDependencies returns the IDs of the downloads the download depends on
+// that the manager does not know, so they can not be waited for.
+func (dm *DownloadManager) MissingDependencies(download *Download) []int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	var missing []int
+	for _, id := range download.DependsOn {
+		if dm.findDownload(id) == nil {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// hasFailedDependency reports whether one of the downloads the download depends on failed.
+func (dm *DownloadManager) hasFailedDependency(download *Download) bool {
+	for _, id := range download.DependsOn {
+		if dependency := dm.findDownload(id); dependency != nil && dependency.Status == "failed" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDone reports whether none of the queue's downloads waits or runs. Paused
+// and failed downloads do not hold it up.
+func (q *Queue) IsDone() bool {
+	for _, download := range q.Downloads {
+		switch download.Status {
+		case "pending", "initializing", "downloading", "merging", "conflict":
+			return false
+		}
+	}
+	return true
+}
+
+// IsWaitingForQueue reports whether the queue waits for the queue it depends on to be done.
+func (dm *DownloadManager) IsWaitingForQueue(queue *Queue) bool {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.isWaitingForQueue(queue)
+}
+
+func (dm *DownloadManager) isWaitingForQueue(queue *Queue) bool {
+	dependency := dm.findQueue(queue.DependsOnQueue)
+	return dependency != nil && !dependency.IsDone()
+}
+
+// SetDependencies makes the download start only after the downloads with the
+// given IDs finished. An empty list removes its dependencies.
+func (dm *DownloadManager) SetDependencies(download *Download, ids []int, policy string) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if policy != "" && !slices.Contains(DependencyPolicies, policy) {
+		return fmt.Errorf("unknown dependency policy %q", policy)
+	}
+	for _, id := range ids {
+		if id == download.ID {
+			return errors.New("a download can not depend on itself")
+		}
+		if dm.findDownload(id) == nil {
+			return fmt.Errorf("download %d does not exist", id)
+		}
+		if dm.dependsOn(id, download.ID, map[int]bool{}) {
+			return fmt.Errorf("download %d already waits for this download", id)
+		}
+	}
+	download.DependsOn = slices.Clone(ids)
+	download.DependencyPolicy = policy
+	if len(ids) == 0 {
+		download.DependencyPolicy = ""
+	}
+	dm.notify(download.Queue)
+	return nil
+}
+
+// dependsOn reports whether the download with ID from waits for the one with ID to, directly or not.
+func (dm *DownloadManager) dependsOn(from, to int, seen map[int]bool) bool {
+	if from == to {
+		return true
+	}
+	if seen[from] {
+		return false
+	}
+	seen[from] = true
+	download := dm.findDownload(from)
+	if download == nil {
+		return false
+	}
+	for _, id := range download.DependsOn {
+		if dm.dependsOn(id, to, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetQueueDependency makes the queue start its downloads only while the queue
+// with the given ID is done, 0 to remove the dependency.
+func (dm *DownloadManager) SetQueueDependency(queue *Queue, id int) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if id != 0 {
+		if id == queue.ID {
+			return errors.New("a queue can not depend on itself")
+		}
+		if dm.findQueue(id) == nil {
+			return fmt.Errorf("queue %d does not exist", id)
+		}
+		seen := map[int]bool{}
+		for dependency := dm.findQueue(id); dependency != nil && !seen[dependency.ID]; dependency = dm.findQueue(dependency.DependsOnQueue) {
+			if dependency.DependsOnQueue == queue.ID {
+				return fmt.Errorf("queue %d already waits for this queue", id)
+			}
+			seen[dependency.ID] = true
+		}
+	}
+	queue.DependsOnQueue = id
+	dm.notify(queue)
+	return nil
+}
+
+// forgetDependency removes a download that is gone from the dependencies of the others.
+func (dm *DownloadManager) forgetDependency(download *Download) {
+	for _, queue := range dm.Queues {
+		for _, d := range queue.Downloads {
+			d.DependsOn = slices.DeleteFunc(d.DependsOn, func(id int) bool { return id == download.ID })
+		}
+	}
+}
+
+// forgetQueueDependency removes a queue that is gone from the dependencies of the others.
+func (dm *DownloadManager) forgetQueueDependency(queue *Queue) {
+	for _, q := range dm.Queues {
+		if q.DependsOnQueue == queue.ID {
+			q.DependsOnQueue = 0
+		}
+	}
+}
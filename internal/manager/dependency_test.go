@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDownloadDependencies(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 128*1024)
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 8, MaxRetries: 1, StartAtOneWorkerAvailable: true}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	dm.PauseQueue(queue) // nothing starts before the dependencies are set
+
+	newDownload := func(id int, url string) *Download {
+		download := &Download{ID: id, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: url}
+		dm.AddDownload(download)
+		return download
+	}
+	first := newDownload(1, server.URL)
+	dm.SetDownloadBandwidth(first, 64)
+	second := newDownload(2, server.URL)
+	broken := newDownload(3, "http://127.0.0.1:1/file.bin") // nothing listens there
+	cascaded, chained := newDownload(4, server.URL), newDownload(5, server.URL)
+	blocked, ignoring := newDownload(6, server.URL), newDownload(7, server.URL)
+	for _, d := range []struct {
+		download *Download
+		ids      []int
+		policy   string
+	}{
+		{second, []int{1}, ""},
+		{cascaded, []int{3}, DependencyCascade},
+		{chained, []int{4}, DependencyCascade},
+		{blocked, []int{3}, DependencyBlock},
+		{ignoring, []int{3}, DependencyIgnore},
+	} {
+		if err := dm.SetDependencies(d.download, d.ids, d.policy); err != nil {
+			t.Fatalf("SetDependencies(%d, %v): %v", d.download.ID, d.ids, err)
+		}
+	}
+	if err := dm.SetDependencies(first, []int{5, 2}, ""); err == nil {
+		t.Error("a dependency cycle was accepted")
+	}
+	dm.ClearQueueState(queue)
+
+	waitForStatus(t, dm, first, 5*time.Second, "downloading")
+	time.Sleep(1500 * time.Millisecond)
+	if status := dm.Status(second); status != "pending" {
+		t.Fatalf("the dependent download is %s before its dependency finished", status)
+	}
+	if waiting := dm.WaitingFor(second); len(waiting) != 1 || waiting[0] != 1 {
+		t.Errorf("WaitingFor = %v, want [1]", waiting)
+	}
+	dm.SetDownloadBandwidth(first, 0)
+	waitForStatus(t, dm, second, 10*time.Second, "finished")
+
+	waitForStatus(t, dm, chained, 5*time.Second, "failed")
+	if status := dm.Status(cascaded); status != "failed" {
+		t.Errorf("the cascading download is %s, want failed", status)
+	}
+	waitForStatus(t, dm, ignoring, 5*time.Second, "finished")
+	if status := dm.Status(blocked); status != "pending" {
+		t.Errorf("the blocked download is %s, want pending", status)
+	}
+
+	dm.RemoveDownload(broken)
+	waitForStatus(t, dm, blocked, 5*time.Second, "finished")
+}
+
+func TestDependenciesAfterRestart(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 128*1024)
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	// loaded as a saved store gives them: one finished before the restart, one removed
+	finished := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "finished", OutputFile: "first.bin", URL: server.URL}
+	dm.AddDownload(finished)
+	dependent := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "second.bin", URL: server.URL,
+		DependsOn: []int{1, 9}}
+	dm.AddDownload(dependent)
+	waitForStatus(t, dm, dependent, 5*time.Second, "finished")
+	if missing := dm.MissingDependencies(dependent); len(missing) != 1 || missing[0] != 9 {
+		t.Errorf("MissingDependencies = %v, want [9]", missing)
+	}
+}
+
+func TestQueueDependency(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 128*1024)
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	first := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	second := &Queue{ID: 2, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(first)
+	dm.AddQueue(second)
+	defer dm.RemoveQueue(first)
+	defer dm.RemoveQueue(second)
+	if err := dm.SetQueueDependency(second, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.SetQueueDependency(first, 2); err == nil {
+		t.Error("a queue dependency cycle was accepted")
+	}
+
+	slow := &Download{ID: 1, QueueID: 1, Queue: first, Status: "pending", OutputFile: "slow.bin", URL: server.URL, MaxBandwidth: 64}
+	later := &Download{ID: 2, QueueID: 2, Queue: second, Status: "pending", OutputFile: "later.bin", URL: server.URL}
+	dm.AddDownload(slow)
+	dm.AddDownload(later)
+	waitForStatus(t, dm, slow, 5*time.Second, "downloading")
+	time.Sleep(1500 * time.Millisecond)
+	if status := dm.Status(later); status != "pending" {
+		t.Fatalf("the download of the dependent queue is %s while the first queue runs", status)
+	}
+	dm.SetDownloadBandwidth(slow, 0)
+	waitForStatus(t, dm, slow, 10*time.Second, "finished")
+	waitForStatus(t, dm, later, 5*time.Second, "finished")
+}
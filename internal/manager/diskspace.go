@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkDiskSpace returns an ErrorDiskFull error when the temp folder or the
+// save folder lacks room for the rest of the download and the queue's free
+// space reserve. When both are on one disk, the parts and the merged file
+// are on it together. Disks whose free space is unknown pass. Callers hold
+// dm.mu.
+func (dm *DownloadManager) checkDiskSpace(download *Download) error {
+	type need struct {
+		dir        string
+		disk       uint64
+		free, size int64
+	}
+	var needs []*need
+	for _, use := range []struct {
+		dir  string
+		size int64
+	}{
+		{dm.TempFolder, download.TotalSize - download.Temps.TotalDownloaded},       // the parts still to download
+		{download.Queue.SaveDir, download.TotalSize - download.Temps.ResumeOffset}, // the merged file
+	} {
+		dir := existingDir(use.dir)
+		free, disk, ok := diskSpace(dir)
+		if !ok {
+			continue
+		}
+		i := 0
+		for i < len(needs) && needs[i].disk != disk {
+			i++
+		}
+		if i == len(needs) {
+			needs = append(needs, &need{dir: dir, disk: disk, free: free})
+		}
+		needs[i].size += max(0, use.size)
+	}
+	reserve := int64(download.Queue.MinFreeSpace) << 20
+	for _, need := range needs {
+		if need.free < need.size+reserve {
+			return &DownloadError{Kind: ErrorDiskFull, Detail: fmt.Sprintf("%d MB free in %s, %d MB needed",
+				need.free>>20, need.dir, (need.size+reserve+1<<20-1)>>20)}
+		}
+	}
+	return nil
+}
+
+// existingDir returns dir or, when it is not created yet, its closest parent
+// that exists, which holds it once it is.
+func existingDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	dm := newTestManager(t)
+	free, _, ok := diskSpace(dm.TempFolder)
+	if !ok {
+		t.Skip("the free space is unknown on this system")
+	}
+	queue := &Queue{ID: 1, SaveDir: filepath.Join(t.TempDir(), "not", "created")}
+	download := &Download{ID: 1, Queue: queue, TotalSize: 1 << 20, Temps: &DownloadTemps{}}
+	if err := dm.checkDiskSpace(download); err != nil {
+		t.Fatalf("1 MB does not fit: %v", err)
+	}
+	for name, change := range map[string]func(){
+		"too large":    func() { download.TotalSize = free + 1 },
+		"past reserve": func() { queue.MinFreeSpace = int(free>>20) + 1 },
+	} {
+		download.TotalSize, queue.MinFreeSpace = 1<<20, 0
+		change()
+		var downloadErr *DownloadError
+		if err := dm.checkDiskSpace(download); !errors.As(err, &downloadErr) || downloadErr.Kind != ErrorDiskFull {
+			t.Errorf("%s: checked with %v, want a full disk", name, err)
+		}
+	}
+}
+
+func TestDiskFullPausesDownload(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to write to")
+	}
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 3}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	// every write to the part fails with ENOSPC
+	partFile := filepath.Join(dm.TempFolder, "file.bin-d1-part-0.tmp")
+	if err := os.Symlink("/dev/full", partFile); err != nil {
+		t.Fatal(err)
+	}
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "paused", "failed", "finished")
+	snapshot := dm.Snapshot(download)
+	if snapshot.Status != "paused" || snapshot.ErrorKind != ErrorDiskFull || snapshot.GetRetries() != 0 {
+		t.Fatalf("the download is %s after %d retries: %s", snapshot.Status, snapshot.GetRetries(), snapshot.LastError)
+	}
+	if entries, _ := os.ReadDir(queue.SaveDir); len(entries) != 0 {
+		t.Errorf("a file was saved from the parts that did not fit")
+	}
+
+	os.Remove(partFile) // room was made
+	dm.ResumeDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+	snapshot = dm.Snapshot(download)
+	if snapshot.Status != "finished" || snapshot.LastError != "" {
+		t.Fatalf("the resumed download is %s: %s", snapshot.Status, snapshot.LastError)
+	}
+
+	// the reserve keeps a download from starting
+	free, _, ok := diskSpace(queue.SaveDir)
+	if !ok {
+		return
+	}
+	dm.UpdateQueue(queue, func(queue *Queue) { queue.MinFreeSpace = int(free>>20) + 1 })
+	second := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "second.bin", URL: server.URL}
+	dm.AddDownload(second)
+	waitForStatus(t, dm, second, 5*time.Second, "paused", "finished")
+	if snapshot := dm.Snapshot(second); snapshot.ErrorKind != ErrorDiskFull || snapshot.Temps.TotalDownloaded != 0 {
+		t.Errorf("the download started past the reserve, %d bytes: %s", snapshot.Temps.TotalDownloaded, snapshot.LastError)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package manager
+
+import "syscall"
+
+// diskSpace returns the bytes free to users on the disk of dir and an ID of
+// that disk.
+func diskSpace(dir string) (free int64, disk uint64, ok bool) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, 0, false
+	}
+	var info syscall.Stat_t
+	if err := syscall.Stat(dir, &info); err != nil {
+		return 0, 0, false
+	}
+	return int64(fs.Bavail) * int64(fs.Bsize), uint64(info.Dev), true
+}
@@ -1,9 +1,15 @@
 package manager
 
 import (
+	"bytes"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 )
@@ -64,19 +70,22 @@ func TestDownloadManager(t *testing.T) {
 	downloadManager.AddDownload(&download1)
 	downloadManager.AddDownload(&download3)
 	downloadManager.AddDownload(&download2)
-	_, _ = download1, download2
 
 	time.Sleep(time.Second * 2)
 	downloadManager.PauseDownload(&download1)
 	time.Sleep(time.Second * 2)
 	downloadManager.ResumeDownload(&download1)
-	queue1.SetBandwith(100)
+	downloadManager.UpdateQueue(&queue1, func(queue *Queue) { queue.SetBandwith(100) })
 	time.Sleep(time.Second * 2)
 
 	for {
 		ended := true
 		for _, queue := range downloadManager.Queues {
-			for _, download := range queue.Downloads {
+			downloadManager.mu.Lock()
+			downloads := slices.Clone(queue.Downloads)
+			downloadManager.mu.Unlock()
+			for _, download := range downloads {
+				download = downloadManager.Snapshot(download)
 				totalKB := 0
 				for _, p := range download.PartDownloaders {
 					// progress := float64(p.Downloaded) / float64(p.End-p.Start+1) * 100
@@ -102,3 +111,104 @@ func TestDownloadManager(t *testing.T) {
 		}
 	}
 }
+
+func newTestFileServer(t *testing.T, content []byte, modTime time.Time) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestManager(t *testing.T) *DownloadManager {
+	dm := NewManager(4, 1)
+	dm.TempFolder = t.TempDir()
+	return dm
+}
+
+func waitForStatus(t *testing.T, dm *DownloadManager, download *Download, timeout time.Duration, statuses ...string) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, status := range statuses {
+			if dm.Status(download) == status {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("download status is %q, want one of %v", dm.Status(download), statuses)
+}
+
+func TestCompletionMetadata(t *testing.T) {
+	content := bytes.Repeat([]byte("gdm"), 1<<20)
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	server := newTestFileServer(t, content, modTime)
+
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 10*time.Second, "finished", "failed")
+
+	if dm.Status(download) != "finished" {
+		t.Fatalf("download %s", dm.Status(download))
+	}
+	if want := filepath.Join(queue.SaveDir, "file.bin"); download.OutputPath != want {
+		t.Errorf("OutputPath = %s, want %s", download.OutputPath, want)
+	}
+	if download.FinalSize != int64(len(content)) {
+		t.Errorf("FinalSize = %d, want %d", download.FinalSize, len(content))
+	}
+	if download.CompletedAt.IsZero() {
+		t.Error("CompletedAt is not set")
+	}
+	info, err := os.Stat(download.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), modTime)
+	}
+}
+
+func TestSkipExistingFileOfSameSize(t *testing.T) {
+	content := bytes.Repeat([]byte("gdm"), 1<<20)
+	var mu sync.Mutex
+	bodies := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-1" {
+			mu.Lock()
+			bodies++
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "file.bin", time.Now(), bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1, ConflictPolicy: ConflictSkip}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	existing := bytes.Repeat([]byte("old"), 1<<20) // same size, so taken as the same file
+	target := filepath.Join(queue.SaveDir, "file.bin")
+	if err := os.WriteFile(target, existing, 0644); err != nil {
+		t.Fatal(err)
+	}
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+
+	if snapshot := dm.Snapshot(download); snapshot.Status != "finished" || snapshot.OutputPath != target {
+		t.Fatalf("the download is %s at %s: %s", snapshot.Status, snapshot.OutputPath, snapshot.LastError)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if bodies != 0 {
+		t.Errorf("downloaded the file %d times before skipping it", bodies)
+	}
+	if saved, _ := os.ReadFile(target); !bytes.Equal(saved, existing) {
+		t.Error("the existing file was replaced")
+	}
+}
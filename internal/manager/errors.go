@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Error kinds, the reason a download failed.
+const (
+	ErrorDNS               = "dns"                // the host name could not be resolved
+	ErrorConnectionRefused = "connection-refused" // nothing listens on the server's port
+	ErrorTimeout           = "timeout"
+	ErrorStalled           = "stalled" // the body stopped coming or came too slowly
+	ErrorTLS               = "tls"     // the secure connection or the certificate failed
+	ErrorNetwork           = "network"
+	ErrorHTTP              = "http" // the server answered with a 4xx or 5xx status
+	ErrorDiskFull          = "disk-full"
+	ErrorPermission        = "permission" // a file or directory could not be written
+	ErrorRemoteChanged     = "remote-changed"
+	ErrorOther             = "other"
+)
+
+// DownloadError is an error classified by its kind, with a message that can
+// be shown to the user as it is.
+type DownloadError struct {
+	Kind       string
+	StatusCode int           // for ErrorHTTP
+	Detail     string        // such as the host, the path or the status text
+	RetryAfter time.Duration // how long the server asked to wait, for ErrorHTTP
+	Err        error
+}
+
+func (e *DownloadError) Error() string {
+	var message string
+	switch e.Kind {
+	case ErrorDNS:
+		message = "host not found"
+	case ErrorConnectionRefused:
+		message = "connection refused"
+	case ErrorTimeout:
+		message = "timed out"
+	case ErrorStalled:
+		message = "stalled"
+	case ErrorTLS:
+		message = "secure connection failed"
+	case ErrorNetwork:
+		message = "network error"
+	case ErrorHTTP:
+		return fmt.Sprintf("HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	case ErrorDiskFull:
+		message = "disk full"
+	case ErrorPermission:
+		message = "permission denied"
+	case ErrorRemoteChanged:
+		message = "file changed on the server"
+	default:
+		if e.Err != nil {
+			return e.Err.Error()
+		}
+		message = "failed"
+	}
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	return message
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// httpError returns the error for a response with an unexpected status.
+func httpError(resp *http.Response) *DownloadError {
+	err := &DownloadError{Kind: ErrorHTTP, StatusCode: resp.StatusCode}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
+
+// classifyError finds the kind of an error returned by the HTTP client or the
+// file system.
+func classifyError(err error) *DownloadError {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr
+	}
+	classified := &DownloadError{Kind: ErrorOther, Err: err}
+
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var pathErr *fs.PathError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &dnsErr):
+		classified.Kind, classified.Detail = ErrorDNS, dnsErr.Name
+	case errors.Is(err, syscall.ECONNREFUSED):
+		classified.Kind = ErrorConnectionRefused
+	case errors.Is(err, syscall.ENOSPC):
+		classified.Kind = ErrorDiskFull
+	case errors.Is(err, fs.ErrPermission):
+		classified.Kind = ErrorPermission
+		if errors.As(err, &pathErr) {
+			classified.Detail = pathErr.Path
+		}
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidCert), errors.As(err, &recordErr), strings.Contains(err.Error(), "tls: "):
+		classified.Kind, classified.Detail = ErrorTLS, tlsDetail(err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		classified.Kind = ErrorTimeout
+	case errors.As(err, &netErr), errors.Is(err, syscall.ECONNRESET):
+		classified.Kind, classified.Detail = ErrorNetwork, err.Error()
+	}
+	return classified
+}
+
+// tlsDetail keeps the part of a TLS error that says what went wrong, without
+// the request it failed for.
+func tlsDetail(err error) string {
+	message := err.Error()
+	for _, prefix := range []string{"tls: ", "x509: "} {
+		if i := strings.Index(message, prefix); i >= 0 {
+			return message[i:]
+		}
+	}
+	return message
+}
+
+// fail marks the download failed for err. Callers hold dm.mu.
+func (dm *DownloadManager) fail(download *Download, err error) {
+	classified := classifyError(err)
+	download.Status = "failed"
+	download.ErrorKind = classified.Kind
+	download.LastError = classified.Error()
+}
+
+// pauseForSpace pauses the download with a full disk as the reason, keeping
+// its parts so that it goes on once the user made room. Callers hold dm.mu.
+func (dm *DownloadManager) pauseForSpace(download *Download, err error) {
+	classified := classifyError(err)
+	download.Status = "paused"
+	download.PausedByQueue = false
+	download.ErrorKind = classified.Kind
+	download.LastError = classified.Error()
+	dm.stopParts(download)
+}
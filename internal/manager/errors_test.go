@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+	_, refused := http.Get("http://" + closed)
+
+	tests := []struct {
+		err  error
+		kind string
+		want string
+	}{
+		{refused, ErrorConnectionRefused, "connection refused"},
+		{&net.DNSError{Err: "no such host", Name: "nowhere.invalid", IsNotFound: true}, ErrorDNS, "host not found: nowhere.invalid"},
+		{&fs.PathError{Op: "open", Path: "/data/file.bin", Err: syscall.EACCES}, ErrorPermission, "permission denied: /data/file.bin"},
+		{fmt.Errorf("write: %w", syscall.ENOSPC), ErrorDiskFull, "disk full"},
+		{context.DeadlineExceeded, ErrorTimeout, "timed out"},
+		{&DownloadError{Kind: ErrorHTTP, StatusCode: 503}, ErrorHTTP, "HTTP 503 Service Unavailable"},
+		{os.ErrClosed, ErrorOther, os.ErrClosed.Error()},
+	}
+	for _, test := range tests {
+		classified := classifyError(test.err)
+		if classified.Kind != test.kind || classified.Error() != test.want {
+			t.Errorf("classifyError(%v) = %s %q, want %s %q", test.err, classified.Kind, classified.Error(), test.kind, test.want)
+		}
+	}
+}
+
+func TestFailureReasons(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	modTime := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case r.URL.Path == "/changed" && r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-1":
+			// a new version without ranges once the parts ask for the file
+			w.Write(bytes.Repeat([]byte("y"), 32*1024))
+		default:
+			http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path string
+		kind string
+	}{
+		{"/missing", ErrorHTTP},
+		{"/changed", ErrorRemoteChanged},
+		{"/file.bin", ""},
+	}
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	for i, test := range tests {
+		download := &Download{
+			ID: i + 1, QueueID: 1, Queue: queue, Status: "pending",
+			OutputFile: fmt.Sprintf("file%d.bin", i), URL: server.URL + test.path,
+		}
+		dm.AddDownload(download)
+		waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+		snapshot := dm.Snapshot(download)
+		if snapshot.ErrorKind != test.kind {
+			t.Errorf("%s failed with %q (%s), want %q", test.path, snapshot.ErrorKind, snapshot.LastError, test.kind)
+		}
+		if test.kind != "" && snapshot.LastError == "" {
+			t.Errorf("%s failed without a reason", test.path)
+		}
+	}
+}
+
+func TestRetryAfterRemoteChange(t *testing.T) {
+	old, changed := bytes.Repeat([]byte("o"), 2*1024*1024+512*1024), bytes.Repeat([]byte("n"), 3*1024*1024)
+	oldTime, newTime := time.Now().Add(-time.Hour), time.Now()
+	for _, retry := range []string{"download", "parts"} {
+		t.Run(retry, func(t *testing.T) {
+			var mu sync.Mutex
+			replaced := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				probe := r.Method == http.MethodHead || r.Header.Get("Range") == "bytes=0-1"
+				serveOld := !replaced && probe // replaced between the probe and the parts
+				mu.Unlock()
+				if serveOld {
+					http.ServeContent(w, r, "file.bin", oldTime, bytes.NewReader(old))
+					return
+				}
+				http.ServeContent(w, r, "file.bin", newTime, bytes.NewReader(changed))
+			}))
+			defer server.Close()
+
+			dm := newTestManager(t)
+			queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+			dm.AddQueue(queue)
+			defer dm.RemoveQueue(queue)
+			download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+			dm.AddDownload(download)
+			waitForStatus(t, dm, download, 5*time.Second, "failed", "finished")
+			if kind := dm.Snapshot(download).ErrorKind; kind != ErrorRemoteChanged {
+				t.Fatalf("failed with %q, want the remote change", kind)
+			}
+
+			mu.Lock()
+			replaced = true
+			mu.Unlock()
+			if retry == "download" {
+				dm.RetryDownload(download)
+			} else if err := dm.RetryParts(download, 0); err != nil {
+				t.Fatal(err)
+			}
+			waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+			snapshot := dm.Snapshot(download)
+			if snapshot.Status != "finished" {
+				t.Fatalf("the retried download is %s: %s", snapshot.Status, snapshot.LastError)
+			}
+			if saved, err := os.ReadFile(snapshot.OutputPath); err != nil || !bytes.Equal(saved, changed) {
+				t.Errorf("the saved file is not the new version: %v", err)
+			}
+		})
+	}
+}
@@ -1,34 +1,22 @@
 package manager
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"time"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
-func IsWithinActiveHours(start, end string) bool {
-
-	now := time.Now()
-	//fmt.Println("Current time:", now)
-	startTime, err := time.Parse("15:04", start)
-	if err != nil {
-		return true
-	}
-	endTime, err := time.Parse("15:04", end)
-	if err != nil {
-		return true
-	}
-	return (now.Hour() > startTime.Hour() ||
-		(now.Minute() >= startTime.Minute() && now.Hour() == startTime.Hour())) &&
-		(now.Hour() < endTime.Hour() ||
-			(now.Hour() == endTime.Hour() && now.Minute() <= endTime.Minute()))
-}
-
 func getFileSize(file string) int64 {
 	fileInfo, err := os.Stat(file)
 	var size int64 = 0
@@ -38,46 +26,128 @@ func getFileSize(file string) int64 {
 	return size
 }
 
-func mergeParts(download *Download) error {
+var errFileConflict = errors.New("target file already exists")
+
+func mergePartsWithPolicy(download *Download, policy string) error {
 	if err := os.MkdirAll(download.Queue.SaveDir, os.ModePerm); err != nil {
 		return err
 	}
 	fullPath := filepath.Join(download.Queue.SaveDir, download.OutputFile)
-	counter := 1
-	for {
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-			break
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if info, err := os.Stat(fullPath); err == nil {
+		switch policy {
+		case ConflictOverwrite:
+		case ConflictResume:
+			if download.Temps == nil || download.Temps.ResumeOffset != info.Size() {
+				fullPath = nextFreePath(fullPath)
+				break
+			}
+			flags = os.O_WRONLY | os.O_APPEND
+		case ConflictSkip:
+			same, err := sameAsParts(fullPath, info.Size(), download.PartDownloaders)
+			if err != nil {
+				return err
+			}
+			if !same {
+				fullPath = nextFreePath(fullPath)
+				break
+			}
+			removeParts(download)
+			download.OutputPath = fullPath
+			return nil
+		case ConflictAsk:
+			return errFileConflict
+		default:
+			fullPath = nextFreePath(fullPath)
 		}
-		newFilename := fmt.Sprintf("%s(%d)%s",
-			download.OutputFile[:len(download.OutputFile)-len(filepath.Ext(download.OutputFile))],
-			counter, filepath.Ext(download.OutputFile),
-		)
-		fullPath = filepath.Join(download.Queue.SaveDir, newFilename)
-		counter++
-	}
-	outFile, err := os.Create(fullPath)
+	}
+	outFile, err := os.OpenFile(fullPath, flags, 0666)
 	if err != nil {
 		return err
 	}
 	defer outFile.Close()
+	// a merge that stops halfway, as on a full disk, leaves no truncated file
+	undo := func() { os.Remove(fullPath) }
+	if flags&os.O_APPEND != 0 {
+		undo = func() { os.Truncate(fullPath, download.Temps.ResumeOffset) }
+	}
 
 	for _, p := range download.PartDownloaders {
 		partFile, err := os.Open(p.TempFile)
 		if err != nil {
+			outFile.Close()
+			undo()
 			return err
 		}
-		defer os.Remove(p.TempFile)
-		defer partFile.Close()
-
 		_, err = io.Copy(outFile, partFile)
+		partFile.Close()
 		if err != nil {
+			outFile.Close()
+			undo()
 			return err
 		}
 	}
-
+	if err := outFile.Close(); err != nil {
+		undo()
+		return err
+	}
+	removeParts(download)
+	download.OutputPath = fullPath
 	return nil
 }
 
+// nextFreePath returns name(1).ext, name(2).ext, ... for the first name not taken.
+func nextFreePath(fullPath string) string {
+	ext := filepath.Ext(fullPath)
+	base := fullPath[:len(fullPath)-len(ext)]
+	for counter := 1; ; counter++ {
+		newPath := fmt.Sprintf("%s(%d)%s", base, counter, ext)
+		if _, err := os.Stat(newPath); os.IsNotExist(err) {
+			return newPath
+		}
+	}
+}
+
+func removeParts(download *Download) {
+	for _, p := range download.PartDownloaders {
+		os.Remove(p.TempFile)
+	}
+}
+
+// sameAsParts reports whether the file has the same size and content as the
+// downloaded parts put together.
+func sameAsParts(file string, size int64, parts []*PartDownloader) (bool, error) {
+	var partsSize int64
+	for _, p := range parts {
+		partsSize += getFileSize(p.TempFile)
+	}
+	if partsSize != size {
+		return false, nil
+	}
+	existing, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer existing.Close()
+	fileHash := sha256.New()
+	if _, err := io.Copy(fileHash, existing); err != nil {
+		return false, err
+	}
+	partsHash := sha256.New()
+	for _, p := range parts {
+		partFile, err := os.Open(p.TempFile)
+		if err != nil {
+			return false, err
+		}
+		_, err = io.Copy(partsHash, partFile)
+		partFile.Close()
+		if err != nil {
+			return false, err
+		}
+	}
+	return bytes.Equal(fileHash.Sum(nil), partsHash.Sum(nil)), nil
+}
+
 func GetFileNameFromURL(URL string) (string, error) {
 	if len(URL) < 2 {
 		return "", errors.New("not enough lenght for URL")
@@ -86,9 +156,118 @@ func GetFileNameFromURL(URL string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	name := sanitizeFileName(path.Base(parsedURL.Path))
+	if name == "" {
+		return "", errors.New("URL has no file name")
+	}
+	return name, nil
+}
+
+// fileNameFromResponse picks a file name for a probed response. It prefers
+// Content-Disposition, then the last path element of the final (redirected)
+// URL, and adds an extension from Content-Type when the name has none.
+func fileNameFromResponse(resp *http.Response) string {
+	name := fileNameFromContentDisposition(resp.Header.Get("Content-Disposition"))
+	if name == "" && resp.Request != nil && resp.Request.URL != nil {
+		name, _ = GetFileNameFromURL(resp.Request.URL.String())
+	}
+	if name == "" {
+		name = "download"
+	}
+	if filepath.Ext(name) == "" {
+		name += extensionFromContentType(resp.Header.Get("Content-Type"))
+	}
+	return name
+}
+
+func fileNameFromContentDisposition(header string) string {
+	if header == "" {
+		return ""
+	}
+	// mime.ParseMediaType decodes RFC 5987 filename*=UTF-8''... values and
+	// prefers them over the plain filename parameter.
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+	return sanitizeFileName(params["filename"])
+}
 
-	return path.Base(parsedURL.Path), nil
+// preferredExtensions picks the usual extension of media types that the mime
+// package knows several extensions for, such as .jpg over .jfif and .jpe.
+var preferredExtensions = map[string]string{
+	"text/html":              ".html",
+	"text/plain":             ".txt",
+	"text/javascript":        ".js",
+	"text/xml":               ".xml",
+	"application/xml":        ".xml",
+	"application/zip":        ".zip",
+	"application/gzip":       ".gz",
+	"application/x-gzip":     ".gz",
+	"application/x-tar":      ".tar",
+	"application/javascript": ".js",
+	"image/jpeg":             ".jpg",
+	"image/tiff":             ".tif",
+	"image/svg+xml":          ".svg",
+	"audio/mpeg":             ".mp3",
+	"audio/mp4":              ".m4a",
+	"video/mp4":              ".mp4",
+	"video/mpeg":             ".mpg",
+	"video/quicktime":        ".mov",
+}
 
+// extensionFromContentType returns the extension for a media type, from
+// preferredExtensions or else the shortest the mime package knows, the first
+// in alphabetical order on a tie, so that the same type always gets the same one.
+func extensionFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/octet-stream" {
+		return ""
+	}
+	if ext, ok := preferredExtensions[mediaType]; ok {
+		return ext
+	}
+	exts, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	slices.Sort(exts)
+	shortest := exts[0]
+	for _, ext := range exts[1:] {
+		if len(ext) < len(shortest) {
+			shortest = ext
+		}
+	}
+	return shortest
+}
+
+// sanitizeFileName strips directories and characters that are not allowed
+// in file names on common filesystems.
+func sanitizeFileName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Base(name)
+	if name == "/" || name == "." {
+		return ""
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		cut := 255 - len(ext)
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut-- // keep a multi-byte character whole
+		}
+		name = name[:cut] + ext
+	}
+	return name
 }
 
 func IsValidURL(URL string) bool {
@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGetFileNameFromURL(t *testing.T) {
+	cases := map[string]string{
+		"https://host/files/archive.tar.gz": "archive.tar.gz",
+		"https://host/download?id=123":      "download",
+		"https://host/dir/a%3Cb%3E.txt":     "a_b_.txt",
+		"https://host/files/report.pdf?x=1": "report.pdf",
+	}
+	for url, want := range cases {
+		got, err := GetFileNameFromURL(url)
+		if err != nil || got != want {
+			t.Errorf("GetFileNameFromURL(%q) = %q, %v; want %q", url, got, err, want)
+		}
+	}
+	if _, err := GetFileNameFromURL("https://host/"); err == nil {
+		t.Error("expected an error for a URL without a file name")
+	}
+}
+
+func TestFileNameFromResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		target := "/"
+		if f := r.URL.Query().Get("f"); f != "" {
+			target = "/cdn/" + f
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+	mux.HandleFunc("/cdn/disposition", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="plain.bin"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`)
+	})
+	mux.HandleFunc("/cdn/unsafe", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="../../etc/pass:wd"`)
+	})
+	mux.HandleFunc("/cdn/data", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cases := map[string]string{
+		"disposition": "résumé.pdf",
+		"unsafe":      "pass_wd",
+		"data":        "data.zip",
+		"":            "download.html",
+	}
+	for f, want := range cases {
+		resp, err := http.Head(server.URL + "/download?f=" + f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := fileNameFromResponse(resp); got != want {
+			t.Errorf("fileNameFromResponse(%q) = %q; want %q", f, got, want)
+		}
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".txt" // 404 bytes
+	got := sanitizeFileName(long)
+	if len(got) > 255 || !utf8.ValidString(got) || !strings.HasSuffix(got, ".txt") {
+		t.Errorf("sanitizeFileName cut a long name to %d bytes %q", len(got), got)
+	}
+}
+
+func TestExtensionFromContentType(t *testing.T) {
+	cases := map[string]string{
+		"image/jpeg":               ".jpg",
+		"text/html; charset=utf-8": ".html",
+		"application/pdf":          ".pdf",
+		"application/octet-stream": "",
+		"not a type":               "",
+	}
+	for contentType, want := range cases {
+		for range 3 { // the same extension every time
+			if got := extensionFromContentType(contentType); got != want {
+				t.Errorf("extensionFromContentType(%q) = %q; want %q", contentType, got, want)
+			}
+		}
+	}
+}
+
+func TestMergePartsConflictPolicies(t *testing.T) {
+	dir := t.TempDir()
+	newDownload := func(content string) *Download {
+		part := filepath.Join(dir, "part.tmp")
+		if err := os.WriteFile(part, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return &Download{
+			Queue:           &Queue{SaveDir: dir},
+			OutputFile:      "file.txt",
+			Temps:           &DownloadTemps{},
+			PartDownloaders: []*PartDownloader{{TempFile: part}},
+		}
+	}
+	target := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	download := newDownload("new")
+	if err := mergePartsWithPolicy(download, ConflictAsk); err != errFileConflict {
+		t.Fatalf("ask: got %v, want errFileConflict", err)
+	}
+	if err := mergePartsWithPolicy(download, ConflictRename); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "file(1).txt"); download.OutputPath != want {
+		t.Errorf("rename: saved to %s, want %s", download.OutputPath, want)
+	}
+
+	download = newDownload("old")
+	if err := mergePartsWithPolicy(download, ConflictSkip); err != nil {
+		t.Fatal(err)
+	}
+	if download.OutputPath != target {
+		t.Errorf("skip: saved to %s, want %s", download.OutputPath, target)
+	}
+
+	download = newDownload("newer")
+	if err := mergePartsWithPolicy(download, ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "newer" {
+		t.Errorf("overwrite: file contains %q", content)
+	}
+
+	download = newDownload(" and more")
+	download.Temps.ResumeOffset = getFileSize(target)
+	if err := mergePartsWithPolicy(download, ConflictResume); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "newer and more" {
+		t.Errorf("resume: file contains %q", content)
+	}
+}
@@ -1,6 +1,8 @@
 package manager
 
 import (
+	"context"
+	"net/http"
 	"strconv"
 	"sync"
 	"time"
@@ -8,20 +10,28 @@ import (
 
 // Queue represents a single queue item
 type Queue struct {
-	PartDownloaders           chan *PartDownloader `json:"-"`
-	Downloads                 []*Download          `json:"-"`
-	tokenBucket               chan struct{}        `json:"-"`
-	ticker                    *time.Ticker         `json:"-"`
-	IsRemoved                 bool                 `json:"-"`
-	ID                        int                  `json:"id"`
-	IsActive                  bool                 `json:"is_active"`
-	SaveDir                   string               `json:"save_dir"`
-	MaxConcurrentDownloads    int                  `json:"max_concurrent_downloads"` // default 10
-	StartAtOneWorkerAvailable bool                 `json:"start_at_one_worker_available"`
-	MaxBandwidth              int                  `json:"max_bandwidth"`     // default 0 for unlimited
-	ActiveStartTime           string               `json:"active_start_time"` // default 00:00
-	ActiveEndTime             string               `json:"active_end_time"`   // default 23:59
-	MaxRetries                int                  `json:"max_retries"`       // default 3
+	workers                   *workerPool       `json:"-"`
+	wake                      chan struct{}     `json:"-"`
+	Downloads                 []*Download       `json:"-"`
+	limiter                   *bandwidthLimiter `json:"-"`
+	IsRemoved                 bool              `json:"-"`
+	ID                        int               `json:"id"`
+	IsActive                  bool              `json:"is_active"`
+	SaveDir                   string            `json:"save_dir"`
+	MaxConcurrentDownloads    int               `json:"max_concurrent_downloads"` // default 10
+	StartAtOneWorkerAvailable bool              `json:"start_at_one_worker_available"`
+	MaxBandwidth              int               `json:"max_bandwidth"`              // default 0 for unlimited
+	BandwidthSchedule         []BandwidthTier   `json:"bandwidth_schedule"`         // tiers override MaxBandwidth
+	ActiveStartTime           string            `json:"active_start_time"`          // default 00:00
+	ActiveEndTime             string            `json:"active_end_time"`            // default 23:59
+	Schedule                  *WeeklySchedule   `json:"schedule,omitempty"`         // overrides the active times
+	MaxRetries                int               `json:"max_retries"`                // default 3
+	RetryPolicy               *RetryPolicy      `json:"retry_policy,omitempty"`     // backoff between retries, default 1s x2 1m 20%
+	ConflictPolicy            string            `json:"conflict_policy"`            // default rename
+	State                     string            `json:"state,omitempty"`            // manual state, overrides the window
+	PausedByAll               bool              `json:"paused_by_all,omitempty"`    // paused by PauseAll, resumed by ResumeAll
+	DependsOnQueue            int               `json:"depends_on_queue,omitempty"` // starts downloads only while this queue is done
+	MinFreeSpace              int               `json:"min_free_space,omitempty"`   // MB left free on the disks of a download, default 0
 }
 
 func (q Queue) FilterValue() string {
@@ -29,27 +39,59 @@ func (q Queue) FilterValue() string {
 }
 
 type Download struct {
-	Temps           *DownloadTemps    `json:"-"`
-	PartDownloaders []*PartDownloader `json:"-"`
-	IsRemoved       bool              `json:"-"`
-	Queue           *Queue            `json:"_"`
-	ID              int               `json:"id"`
-	QueueID         int               `json:"queue_id"`
-	IsActive        bool              `json:"is_active"`
-	Status          string            `json:"status"`
-	TotalSize       int64             `json:"total_size"`
-	IsPartial       bool              `json:"is_partial"`
-	OutputFile      string            `json:"output_file"`
-	URL             string            `json:"url"`
+	Temps            *DownloadTemps    `json:"-"`
+	PartDownloaders  []*PartDownloader `json:"-"`
+	IsRemoved        bool              `json:"-"`
+	limiter          *bandwidthLimiter `json:"-"`
+	Queue            *Queue            `json:"_"`
+	ID               int               `json:"id"`
+	QueueID          int               `json:"queue_id"`
+	IsActive         bool              `json:"is_active"`
+	Status           string            `json:"status"`
+	TotalSize        int64             `json:"total_size"`
+	IsPartial        bool              `json:"is_partial"`
+	OutputFile       string            `json:"output_file"`
+	OutputPath       string            `json:"output_path"`                 // where the file was saved
+	ConflictPolicy   string            `json:"conflict_policy,omitempty"`   // overrides the queue policy
+	RecurringID      int               `json:"recurring_id,omitempty"`      // the recurring download that created it
+	Priority         string            `json:"priority,omitempty"`          // default normal
+	Order            int               `json:"order"`                       // manual place in the queue within its priority
+	PausedByQueue    bool              `json:"paused_by_queue,omitempty"`   // resumed when the queue runs again
+	DependsOn        []int             `json:"depends_on,omitempty"`        // IDs of the downloads to finish first
+	DependencyPolicy string            `json:"dependency_policy,omitempty"` // default block
+	URL              string            `json:"url"`
+	MaxBandwidth     int               `json:"max_bandwidth"`           // default 0 for unlimited
+	StartAt          time.Time         `json:"start_at"`                // zero to start as soon as the queue allows
+	StopAt           time.Time         `json:"stop_at"`                 // zero for no deadline
+	LastModified     string            `json:"last_modified,omitempty"` // Last-Modified header of the server
+	CompletedAt      time.Time         `json:"completed_at"`
+	AverageSpeed     int64             `json:"average_speed"` // bytes per second
+	FinalSize        int64             `json:"final_size"`
+	LastError        string            `json:"last_error,omitempty"` // why it failed last, cleared once it finishes
+	ErrorKind        string            `json:"error_kind,omitempty"` // one of the Error kinds
 }
 
 type DownloadTemps struct {
 	TotalDownloaded int64
-	Retries         int
+	Retries         int // retries to reach the server before the parts start
 	StartTime       time.Time
-	Mutex           *sync.Mutex
+	ResumeOffset    int64              // bytes already present in the target file
+	InitialSize     int64              // bytes already downloaded when this session started
+	ResumeAfterStop bool               // resumed while its parts were still stopping
+	stop            context.CancelFunc // stops its parts, nil while they do not run
 }
 
+// File conflict policies, applied when the target file already exists.
+const (
+	ConflictRename    = "rename"    // save as name(1).ext, name(2).ext, ...
+	ConflictOverwrite = "overwrite" // replace the existing file
+	ConflictSkip      = "skip"      // keep the existing file if it has the same size, or content when the size is unknown
+	ConflictResume    = "resume"    // continue into the existing file
+	ConflictAsk       = "ask"       // wait for the user to choose
+)
+
+var ConflictPolicies = []string{ConflictRename, ConflictOverwrite, ConflictSkip, ConflictResume, ConflictAsk}
+
 type PartDownloader struct {
 	Index      int
 	Start      int64
@@ -59,19 +101,80 @@ type PartDownloader struct {
 	TempFile   string
 	IsFailed   bool
 	IsPaused   bool
+	Retries    int   // retries of this part, apart from those of the download
+	Err        error // why it failed
 }
 
 type DownloadManager struct {
-	Queues     []*Queue
-	MaxParts   int
-	PartSize   int
-	TempFolder string
+	// mu guards the queues, downloads and recurring downloads of the manager
+	// and everything in them. Readers outside the package work on snapshots.
+	mu sync.Mutex
+
+	Clock           Clock
+	Queues          []*Queue
+	MaxParts        int
+	PartSize        int
+	TempFolder      string
+	GlobalBandwidth int // KB/s for all queues together, 0 for unlimited
+	limiter         *bandwidthLimiter
+
+	MaxConnections        int // open connections of all queues together, 0 for unlimited
+	MaxConnectionsPerHost int // open connections to a single host, 0 for unlimited
+	connections           *connectionLimiter
+
+	Timeouts         Timeouts             // of every request, see SetTimeouts
+	IdleConnsPerHost int                  // idle connections kept for reuse, see SetIdleConnections
+	transport        *http.Transport      // shared by every request
+	probes           map[string]hostProbe // what probing each host found out, see probeURL
+	settled          chan struct{}        // closed when a download may have finished, failed or been removed
+
+	ctx      context.Context // done once Shutdown is called
+	shutdown context.CancelFunc
+	running  sync.WaitGroup // downloads whose parts run or that are merged
+	store    *DataStore     // saved by Shutdown, see UseStore
+
+	// RecurringDownloads receives the downloads started by recurring
+	// definitions. The owner of the DataStore gives them an ID and adds them.
+	RecurringDownloads chan *Download
+}
+
+// Settings holds the options that apply to the whole manager
+type Settings struct {
+	GlobalBandwidth       int       `json:"global_bandwidth"`         // default 0 for unlimited
+	MaxConnections        int       `json:"max_connections"`          // default 0 for unlimited
+	MaxConnectionsPerHost int       `json:"max_connections_per_host"` // default 0 for unlimited
+	Timeouts              *Timeouts `json:"timeouts,omitempty"`       // default DefaultTimeouts
+	IdleConnsPerHost      int       `json:"idle_conns_per_host"`      // default 16
 }
 
 // DataStore holds the queues and downloads
 type DataStore struct {
-	Queues    map[string]*Queue    `json:"queues"`    // Map with ID as key and Queue as value
-	Downloads map[string]*Download `json:"downloads"` // Map with ID as key and generic download data
+	manager    *DownloadManager      `json:"-"`         // locked while saving, see UseStore
+	Queues     map[string]*Queue     `json:"queues"`    // Map with ID as key and Queue as value
+	Downloads  map[string]*Download  `json:"downloads"` // Map with ID as key and generic download data
+	Settings   *Settings             `json:"settings"`
+	Recurrings map[string]*Recurring `json:"recurrings"`
+}
+
+// GetConflictPolicy returns the download's own policy or falls back to its queue's.
+func (d *Download) GetConflictPolicy() string {
+	if d.ConflictPolicy != "" {
+		return d.ConflictPolicy
+	}
+	if d.Queue != nil && d.Queue.ConflictPolicy != "" {
+		return d.Queue.ConflictPolicy
+	}
+	return ConflictRename
+}
+
+// IsWaitingToStart reports whether the download is scheduled to start after now.
+func (d *Download) IsWaitingToStart(now time.Time) bool {
+	return !d.StartAt.IsZero() && now.Before(d.StartAt)
+}
+
+// IsPastStop reports whether the download's deadline has passed.
+func (d *Download) IsPastStop(now time.Time) bool {
+	return !d.StopAt.IsZero() && !now.Before(d.StopAt)
 }
 
 func (d *Download) GetStatus() string {
@@ -84,6 +187,18 @@ func (d *Download) GetSpeed() int {
 	}
 	return totalKB
 }
+
+// GetRetries returns the retries of the download and of its parts together.
+func (d *Download) GetRetries() int {
+	retries := 0
+	if d.Temps != nil {
+		retries = d.Temps.Retries
+	}
+	for _, p := range d.PartDownloaders {
+		retries += p.Retries
+	}
+	return retries
+}
 func (d *Download) GetProgress() int {
 	if d.TotalSize == 0 || d.Temps == nil {
 		return 0
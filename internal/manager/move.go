@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// checkMove tells whether the download may leave its queue for the given one.
+func checkMove(download *Download, queue *Queue) error {
+	switch download.Status {
+	case "pending", "paused", "failed":
+	default:
+		return fmt.Errorf("a download that is %s can not be moved", download.Status)
+	}
+	if queue == nil || queue.IsRemoved {
+		return errors.New("the queue does not exist")
+	}
+	// parts laid out after a partial file would not fit a fresh file in the new queue
+	from := download.Queue
+	if from != nil && download.GetConflictPolicy() == ConflictResume && download.OutputFile != "" &&
+		getFileSize(filepath.Join(from.SaveDir, download.OutputFile)) > 0 {
+		moved := *download
+		moved.Queue = queue
+		if from.SaveDir != queue.SaveDir || moved.GetConflictPolicy() != ConflictResume {
+			return errors.New("the download resumes a file in the save directory of its queue")
+		}
+	}
+	return nil
+}
+
+func (q *Queue) removeDownload(download *Download) {
+	var updatedDownloads []*Download
+	for _, d := range q.Downloads {
+		if d.ID != download.ID {
+			updatedDownloads = append(updatedDownloads, d)
+		}
+	}
+	q.Downloads = updatedDownloads
+}
+
+// MoveDownloadToQueue reassigns a pending, paused or failed download to
+// another queue. Its parts are kept, and from its next start it saves to the
+// new queue's directory under the new queue's bandwidth and concurrency.
+func (dm *DownloadManager) MoveDownloadToQueue(download *Download, queue *Queue) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if download.Queue == queue {
+		return nil
+	}
+	if err := checkMove(download, queue); err != nil {
+		return err
+	}
+	if download.Queue != nil {
+		download.Queue.removeDownload(download)
+		dm.notify(download.Queue)
+	}
+	download.Queue = queue
+	download.QueueID = queue.ID
+	download.Order = queue.nextOrder()
+	queue.Downloads = append(queue.Downloads, download)
+	dm.notify(queue)
+	return nil
+}
+
+// MoveDownload reassigns a stored download to another queue while gdm is not
+// running, as MoveDownloadToQueue does for a running manager.
+func (data *DataStore) MoveDownload(downloadID, queueID int) error {
+	download := data.Downloads[strconv.Itoa(downloadID)]
+	if download == nil {
+		return fmt.Errorf("download %d does not exist", downloadID)
+	}
+	queue := data.Queues[strconv.Itoa(queueID)]
+	if queue == nil {
+		return fmt.Errorf("queue %d does not exist", queueID)
+	}
+	if download.QueueID == queueID {
+		return nil
+	}
+	download.Queue = data.Queues[strconv.Itoa(download.QueueID)]
+	if download.Status == "initializing" || download.Status == "downloading" {
+		download.Status = "pending" // nothing runs while gdm is closed, it restarts as pending
+	}
+	if err := checkMove(download, queue); err != nil {
+		return err
+	}
+
+	order := 0
+	for _, d := range data.Downloads {
+		if d.QueueID == queueID {
+			order = max(order, d.Order)
+		}
+	}
+	download.Queue = queue
+	download.QueueID = queue.ID
+	download.Order = order + 1
+	return data.Save()
+}
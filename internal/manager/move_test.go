@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveDownloadToQueue(t *testing.T) {
+	server := newTestFileServer(t, []byte("moved"), time.Now())
+	clock := &fakeClock{now: mustTime(t, "2026-10-19 08:00", "UTC")}
+	dm := newTestManager(t)
+	dm.Clock = clock
+
+	schedule, _ := ParseWeeklySchedule("09:00-10:00", "UTC", "")
+	closed := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1, Schedule: schedule}
+	open := &Queue{ID: 2, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1}
+	dm.AddQueue(closed)
+	dm.AddQueue(open)
+	defer dm.RemoveQueue(closed)
+	defer dm.RemoveQueue(open)
+
+	download := &Download{ID: 1, QueueID: 1, Queue: closed, Status: "pending", OutputFile: "file.txt", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "pending")
+	if err := dm.MoveDownloadToQueue(download, open); err != nil {
+		t.Fatal(err)
+	}
+	if download.QueueID != 2 || len(closed.Downloads) != 0 || len(open.Downloads) != 1 {
+		t.Fatalf("download is in queue %d, queues hold %d and %d downloads", download.QueueID, len(closed.Downloads), len(open.Downloads))
+	}
+	waitForStatus(t, dm, download, 5*time.Second, "finished")
+	if got, _ := os.ReadFile(filepath.Join(open.SaveDir, "file.txt")); string(got) != "moved" {
+		t.Errorf("the new queue's directory holds %q", got)
+	}
+
+	if err := dm.MoveDownloadToQueue(download, closed); err == nil {
+		t.Error("a finished download was moved")
+	}
+}
+
+func TestDataStoreMoveDownload(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	data := LoadData()
+	data.AddQueue(&Queue{ID: 1, SaveDir: t.TempDir()})
+	data.AddQueue(&Queue{ID: 2, SaveDir: t.TempDir()})
+	data.AddDownload(&Download{ID: 1, QueueID: 1, Status: "downloading", OutputFile: "a.bin"})
+	data.AddDownload(&Download{ID: 2, QueueID: 2, Status: "paused", OutputFile: "b.bin", Order: 4})
+	data.AddDownload(&Download{ID: 3, QueueID: 1, Status: "finished", OutputFile: "c.bin"})
+
+	if err := data.MoveDownload(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.MoveDownload(3, 2); err == nil {
+		t.Error("a finished download was moved")
+	}
+	if err := data.MoveDownload(1, 9); err == nil {
+		t.Error("a download was moved to a missing queue")
+	}
+
+	moved := LoadData().Downloads["1"]
+	if moved.QueueID != 2 || moved.Order != 5 || moved.Status != "pending" {
+		t.Errorf("stored download is in queue %d at order %d as %s, want queue 2 at order 5 as pending",
+			moved.QueueID, moved.Order, moved.Status)
+	}
+}
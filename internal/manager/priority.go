@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"maps"
+	"slices"
+	"sort"
+)
+
+// Download priorities. The scheduler starts higher priorities first and keeps
+// the manual order within the same priority.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// Directions for MoveDownload.
+const (
+	MoveUp     = "up"
+	MoveDown   = "down"
+	MoveTop    = "top"
+	MoveBottom = "bottom"
+)
+
+// GetPriority returns the download's priority, normal when it has none.
+func (d *Download) GetPriority() string {
+	if d.Priority == "" {
+		return PriorityNormal
+	}
+	return d.Priority
+}
+
+func priorityRank(priority string) int {
+	switch priority {
+	case PriorityHigh:
+		return 0
+	case PriorityLow:
+		return 2
+	}
+	return 1
+}
+
+// OrderedDownloads returns the queue's downloads in the order the scheduler
+// starts them: by priority, then by their manual order.
+func (q *Queue) OrderedDownloads() []*Download {
+	downloads := slices.Clone(q.Downloads)
+	sort.SliceStable(downloads, func(i, j int) bool {
+		a, b := downloads[i], downloads[j]
+		if rankA, rankB := priorityRank(a.GetPriority()), priorityRank(b.GetPriority()); rankA != rankB {
+			return rankA < rankB
+		}
+		return a.Order < b.Order
+	})
+	return downloads
+}
+
+// Position returns the 1-based place of the download among the queue's
+// unfinished downloads in scheduling order, or 0 when it is not among them.
+func (q *Queue) Position(download *Download) int {
+	return q.Positions()[download.ID]
+}
+
+// Positions returns the places of all the queue's unfinished downloads by
+// their ID, as Position does.
+func (q *Queue) Positions() map[int]int {
+	positions := map[int]int{}
+	for _, d := range q.OrderedDownloads() {
+		if d.Status != "finished" {
+			positions[d.ID] = len(positions) + 1
+		}
+	}
+	return positions
+}
+
+// nextOrder places a new download after the others in the queue.
+func (q *Queue) nextOrder() int {
+	order := 0
+	for _, download := range q.Downloads {
+		order = max(order, download.Order)
+	}
+	return order + 1
+}
+
+// MoveDownload moves the download up, down, to the top or to the bottom among
+// the downloads of its queue with the same priority.
+func (q *Queue) MoveDownload(download *Download, where string) {
+	ordered := q.OrderedDownloads()
+	var group []*Download
+	for _, d := range ordered {
+		if d.GetPriority() == download.GetPriority() {
+			group = append(group, d)
+		}
+	}
+	index := slices.Index(group, download)
+	if index < 0 {
+		return
+	}
+	group = slices.Delete(group, index, index+1)
+	switch where {
+	case MoveUp:
+		index = max(index-1, 0)
+	case MoveDown:
+		index = min(index+1, len(group))
+	case MoveTop:
+		index = 0
+	case MoveBottom:
+		index = len(group)
+	}
+	group = slices.Insert(group, index, download)
+
+	// the group keeps its slots in the queue, filled in the new order
+	next := 0
+	for i, d := range ordered {
+		if d.GetPriority() == download.GetPriority() {
+			ordered[i] = group[next]
+			next++
+		}
+	}
+	for i, d := range ordered {
+		d.Order = i + 1
+	}
+}
+
+// Position returns the place of the download, or of a snapshot of it, in its
+// queue, as Queue.Position does.
+func (dm *DownloadManager) Position(download *Download) int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	queue := dm.findQueue(download.QueueID)
+	if queue == nil {
+		return 0
+	}
+	for _, d := range queue.Downloads {
+		if d.ID == download.ID {
+			return queue.Position(d)
+		}
+	}
+	return 0
+}
+
+// Positions returns the places of the unfinished downloads of every queue by
+// their ID, as Queue.Position does, sorting each queue once.
+func (dm *DownloadManager) Positions() map[int]int {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	positions := map[int]int{}
+	for _, queue := range dm.Queues {
+		if !queue.IsRemoved {
+			maps.Copy(positions, queue.Positions())
+		}
+	}
+	return positions
+}
+
+// MoveDownload moves the download among the downloads of its queue, as
+// Queue.MoveDownload does, and lets the scheduler see the new order.
+func (dm *DownloadManager) MoveDownload(download *Download, where string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	download.Queue.MoveDownload(download, where)
+	dm.notify(download.Queue)
+}
+
+// SetPriority changes the priority of the download.
+func (dm *DownloadManager) SetPriority(download *Download, priority string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	download.Priority = priority
+	dm.notify(download.Queue)
+}
@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMoveDownload(t *testing.T) {
+	queue := &Queue{}
+	names := map[*Download]string{}
+	for i, name := range []string{"a", "b", "c", "d"} {
+		download := &Download{ID: i + 1, Order: i + 1}
+		names[download] = name
+		queue.Downloads = append(queue.Downloads, download)
+	}
+	a, b, c, d := queue.Downloads[0], queue.Downloads[1], queue.Downloads[2], queue.Downloads[3]
+	order := func() string {
+		result := ""
+		for _, download := range queue.OrderedDownloads() {
+			result += names[download]
+		}
+		return result
+	}
+
+	b.Priority = PriorityLow
+	c.Priority = PriorityHigh
+	if got := order(); got != "cadb" {
+		t.Fatalf("order by priority = %s, want cadb", got)
+	}
+	queue.MoveDownload(d, MoveUp)
+	if got := order(); got != "cdab" {
+		t.Errorf("after moving d up = %s, want cdab", got)
+	}
+	queue.MoveDownload(d, MoveUp) // already first among the normal ones
+	queue.MoveDownload(b, MoveTop)
+	if got := order(); got != "cdab" {
+		t.Errorf("moves within a single priority changed the order to %s", got)
+	}
+	queue.MoveDownload(d, MoveBottom)
+	a.Priority = PriorityHigh
+	if got := order(); got != "cadb" {
+		t.Errorf("after moving d to the bottom and raising a = %s, want cadb", got)
+	}
+	queue.MoveDownload(a, MoveTop)
+	if got := order(); got != "acdb" {
+		t.Errorf("after moving a to the top = %s, want acdb", got)
+	}
+	if position := queue.Position(b); position != 4 {
+		t.Errorf("position of b = %d, want 4", position)
+	}
+}
+
+func TestSchedulerFollowsPriority(t *testing.T) {
+	var mu sync.Mutex
+	var started []string
+	content := bytes.Repeat([]byte("x"), 1024)
+	modTime := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-1" {
+			mu.Lock()
+			started = append(started, r.URL.Path[1:])
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	clock := &fakeClock{now: mustTime(t, "2026-10-19 08:00", "UTC")}
+	dm := newTestManager(t)
+	dm.Clock = clock
+	schedule, _ := ParseWeeklySchedule("09:00-10:00", "UTC", "")
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 1, MaxRetries: 1, Schedule: schedule}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	priorities := map[string]string{"a": PriorityNormal, "b": PriorityLow, "c": PriorityHigh, "d": ""}
+	var downloads []*Download
+	for i, name := range []string{"a", "b", "c", "d"} {
+		download := &Download{ID: i + 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: name,
+			URL: server.URL + "/" + name, Priority: priorities[name]}
+		dm.AddDownload(download)
+		downloads = append(downloads, download)
+	}
+	for _, download := range downloads {
+		waitForStatus(t, dm, download, 5*time.Second, "pending")
+	}
+	queue.MoveDownload(downloads[3], MoveTop)
+
+	clock.Set(mustTime(t, "2026-10-19 09:00", "UTC"))
+	for _, download := range downloads {
+		waitForStatus(t, dm, download, 10*time.Second, "finished")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"c", "d", "a", "b"}; !slices.Equal(started, want) {
+		t.Errorf("downloads started in order %v, want %v", started, want)
+	}
+}
@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	probeExpiry    = time.Hour // how long what a host told is trusted
+	maxProbedHosts = 256       // hosts remembered, the oldest is forgotten first
+)
+
+// remoteFile is what the server tells about a URL before it is downloaded.
+type remoteFile struct {
+	size         int64 // 0 when the server does not tell
+	lastModified string
+	fileName     string
+	partial      bool // the server answers range requests
+}
+
+// hostProbe is what probing a host found out, reused for its next URLs.
+type hostProbe struct {
+	headRejected bool // HEAD is refused, so the host is probed with a GET alone
+	ranges       bool // range requests were answered for one of its files
+	at           time.Time
+}
+
+// probeURL asks the server for the size and name of the file and whether it
+// can be downloaded in parts. It asks with HEAD, then with a GET of the first
+// bytes, whose Content-Range tells whether ranges are answered and the size
+// when HEAD gave none. What the host answered is remembered for a while:
+// hosts that refuse HEAD are probed with the GET alone, and the GET is left
+// out when the host answered ranges before and HEAD gives the size and
+// advertises ranges for this file as well.
+func (dm *DownloadManager) probeURL(ctx context.Context, client *http.Client, rawURL string) (*remoteFile, error) {
+	host := connectionHost(rawURL)
+	known, ok := dm.probedHost(host)
+	probe := hostProbe{headRejected: known.headRejected}
+
+	var head *http.Response
+	if !probe.headRejected {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		discardBody(resp)
+		switch resp.StatusCode {
+		case http.StatusOK:
+			head = resp
+		case http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			probe.headRejected = true
+		default:
+			return nil, httpError(resp)
+		}
+	}
+	if ok && known.ranges && head != nil && head.ContentLength > 0 && head.Header.Get("Accept-Ranges") == "bytes" {
+		return &remoteFile{
+			size:         head.ContentLength,
+			lastModified: head.Header.Get("Last-Modified"),
+			fileName:     fileNameFromResponse(head),
+			partial:      true,
+		}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	discardBody(resp)
+	file := &remoteFile{}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		// a total of * leaves the size unknown, and parts need the size
+		file.size = contentRangeTotal(resp)
+		file.partial = file.size > 0
+	case resp.StatusCode == http.StatusOK:
+		file.size = max(0, resp.ContentLength) // -1 for a chunked body
+	case head == nil:
+		return nil, httpError(resp)
+	}
+	// else the server knows the file but not the range, as for an empty file
+	// one file without ranges, such as an empty one, says nothing of the others
+	probe.ranges = known.ranges || file.partial
+	dm.rememberProbe(host, probe)
+
+	if head != nil {
+		if file.size == 0 {
+			file.size = max(0, head.ContentLength)
+		}
+		resp = head // its headers are meant for the whole file
+	}
+	file.lastModified = resp.Header.Get("Last-Modified")
+	file.fileName = fileNameFromResponse(resp)
+	return file, nil
+}
+
+// probedHost returns what probing the host found out, unless it is too old.
+func (dm *DownloadManager) probedHost(host string) (hostProbe, bool) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	probe, ok := dm.probes[host]
+	if !ok || dm.Clock.Now().Sub(probe.at) > probeExpiry {
+		return hostProbe{}, false
+	}
+	return probe, true
+}
+
+// rememberProbe keeps what probing the host found out, forgetting the host
+// probed longest ago when maxProbedHosts are remembered.
+func (dm *DownloadManager) rememberProbe(host string, probe hostProbe) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if _, ok := dm.probes[host]; !ok && len(dm.probes) >= maxProbedHosts {
+		oldest := ""
+		for other, known := range dm.probes {
+			if oldest == "" || known.at.Before(dm.probes[oldest].at) {
+				oldest = other
+			}
+		}
+		delete(dm.probes, oldest)
+	}
+	probe.at = dm.Clock.Now()
+	dm.probes[host] = probe
+}
+
+// contentRangeTotal returns the total size in the Content-Range of a
+// response, 0 when it is missing or unknown.
+func contentRangeTotal(resp *http.Response) int64 {
+	contentRange := resp.Header.Get("Content-Range")
+	slash := strings.LastIndex(contentRange, "/")
+	if slash < 0 {
+		return 0
+	}
+	total, err := strconv.ParseInt(contentRange[slash+1:], 10, 64)
+	if err != nil || total < 0 {
+		return 0
+	}
+	return total
+}
@@ -0,0 +1,257 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProbeURL(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	modTime := time.Now()
+	// chunked answers without a Content-Length, and a range only when ranges is set
+	chunked := func(ranges bool, total string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				return
+			}
+			if ranges && r.Header.Get("Range") != "" {
+				w.Header().Set("Content-Range", "bytes 0-1/"+total)
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[:2])
+				return
+			}
+			w.(http.Flusher).Flush()
+			w.Write(content)
+		}
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		size    int64
+		partial bool
+		status  int // of the error, 0 for none
+	}{
+		{"head refused", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+		}, 4096, true, 0},
+		{"size in content range only", chunked(true, "4096"), 4096, true, 0},
+		{"unknown total", chunked(true, "*"), 0, false, 0},
+		{"no ranges and no size", chunked(false, ""), 0, false, 0},
+		{"missing", http.NotFound, 0, false, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(test.handler)
+			defer server.Close()
+			dm := newTestManager(t)
+			file, err := dm.probeURL(context.Background(), dm.client(), server.URL+"/file.bin")
+			var downloadErr *DownloadError
+			switch {
+			case test.status != 0:
+				if !errors.As(err, &downloadErr) || downloadErr.StatusCode != test.status {
+					t.Errorf("probed with %v, want HTTP %d", err, test.status)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case file.size != test.size || file.partial != test.partial || file.fileName != "file.bin":
+				t.Errorf("probed %+v, want size %d, partial %v", *file, test.size, test.partial)
+			}
+		})
+	}
+}
+
+func TestProbeRemembersHostsRefusingHead(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 256*1024)
+	modTime := time.Now()
+	var mu sync.Mutex
+	heads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead { // as presigned URLs signed for GET do
+			mu.Lock()
+			heads++
+			mu.Unlock()
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	for i := 1; i <= 2; i++ {
+		download := &Download{ID: i, QueueID: 1, Queue: queue, Status: "pending",
+			OutputFile: fmt.Sprintf("file%d.bin", i), URL: server.URL}
+		dm.AddDownload(download)
+		waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+		snapshot := dm.Snapshot(download)
+		if snapshot.Status != "finished" || !snapshot.IsPartial || len(snapshot.PartDownloaders) != 2 {
+			t.Fatalf("the download is %s in %d parts: %s", snapshot.Status, len(snapshot.PartDownloaders), snapshot.LastError)
+		}
+		if saved, err := os.ReadFile(snapshot.OutputPath); err != nil || !bytes.Equal(saved, content) {
+			t.Errorf("the saved file differs from the served one: %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if heads != 1 {
+		t.Errorf("HEAD was asked %d times, want once for the host", heads)
+	}
+}
+
+func TestProbeRemembersHostOutcome(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	modTime := time.Now()
+	var mu sync.Mutex
+	rangeGets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			mu.Lock()
+			rangeGets++
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dm := newTestManager(t)
+	clock := &fakeClock{now: time.Now()}
+	dm.Clock = clock
+	probe := func(path string) {
+		t.Helper()
+		file, err := dm.probeURL(context.Background(), dm.client(), server.URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.size != int64(len(content)) || !file.partial || file.fileName != "file.bin" {
+			t.Errorf("probed %+v", *file)
+		}
+	}
+	probe("/a/file.bin")
+	probe("/b/file.bin") // HEAD agrees with the ranges answered before
+	clock.Set(clock.Now().Add(probeExpiry + time.Minute))
+	probe("/c/file.bin")
+	mu.Lock()
+	if rangeGets != 2 {
+		t.Errorf("asked for a range %d times, want once and again after the expiry", rangeGets)
+	}
+	mu.Unlock()
+
+	for i := range maxProbedHosts + 10 {
+		dm.rememberProbe(fmt.Sprintf("host%d", i), hostProbe{})
+	}
+	if len(dm.probes) != maxProbedHosts {
+		t.Errorf("remembered %d hosts, want at most %d", len(dm.probes), maxProbedHosts)
+	}
+}
+
+func TestProbeAfterFileWithoutRanges(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	modTime := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			http.ServeContent(w, r, "empty.bin", modTime, bytes.NewReader(nil))
+			return
+		}
+		if r.Method == http.MethodHead { // as servers that do not advertise ranges
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			return
+		}
+		http.ServeContent(w, r, "big.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dm := newTestManager(t)
+	for _, test := range []struct {
+		path    string
+		partial bool
+	}{{"/empty", false}, {"/big", true}} {
+		file, err := dm.probeURL(context.Background(), dm.client(), server.URL+test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.partial != test.partial {
+			t.Errorf("probed %s as %+v, want partial %v", test.path, *file, test.partial)
+		}
+	}
+}
+
+func TestUnknownSizeDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 16*1024)
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return // no size and no ranges, as a stream
+		}
+		mu.Lock()
+		requests++
+		drop := requests == 2 // the first GET is the probe
+		mu.Unlock()
+		w.(http.Flusher).Flush()
+		if drop {
+			w.Write(content[:32*1024])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		name       string
+		maxRetries int
+		status     string
+	}{{"starts over", 1, "finished"}, {"fails without retries", 0, "failed"}} {
+		t.Run(test.name, func(t *testing.T) {
+			mu.Lock()
+			requests = 0
+			mu.Unlock()
+			dm := newTestManager(t)
+			queue := &Queue{
+				ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: test.maxRetries,
+				RetryPolicy: &RetryPolicy{BaseDelay: time.Millisecond, Factor: 1, MaxDelay: time.Millisecond},
+			}
+			dm.AddQueue(queue)
+			defer dm.RemoveQueue(queue)
+			download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "stream.bin", URL: server.URL}
+			dm.AddDownload(download)
+			waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+
+			snapshot := dm.Snapshot(download)
+			if snapshot.Status != test.status || snapshot.IsPartial {
+				t.Fatalf("the download is %s, partial %v: %s", snapshot.Status, snapshot.IsPartial, snapshot.LastError)
+			}
+			if test.status == "failed" {
+				if snapshot.LastError == "" || snapshot.TotalSize != 0 {
+					t.Errorf("failed with %q and a size of %d", snapshot.LastError, snapshot.TotalSize)
+				}
+				return
+			}
+			if retries := snapshot.GetRetries(); retries != 1 {
+				t.Errorf("started over %d times, want once", retries)
+			}
+			if snapshot.FinalSize != int64(len(content)) || snapshot.TotalSize != snapshot.FinalSize {
+				t.Errorf("recorded a final size of %d and a total of %d, want %d", snapshot.FinalSize, snapshot.TotalSize, len(content))
+			}
+			if saved, err := os.ReadFile(snapshot.OutputPath); err != nil || !bytes.Equal(saved, content) {
+				t.Errorf("the saved file differs from the served one: %v", err)
+			}
+		})
+	}
+}
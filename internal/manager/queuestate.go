@@ -0,0 +1,115 @@
+package manager
+
+import "time"
+
+// Manual queue states. They override the queue's time window until cleared,
+// an empty state follows the window.
+const (
+	QueueRunning  = "running"  // runs even outside the window
+	QueuePaused   = "paused"   // pauses its running downloads and starts none
+	QueueDraining = "draining" // lets running downloads finish but starts no new ones
+)
+
+// IsRunningAt reports whether the queue may run downloads at now, by its
+// manual state or else by its time window.
+func (q *Queue) IsRunningAt(now time.Time) bool {
+	switch q.State {
+	case QueueRunning, QueueDraining:
+		return true
+	case QueuePaused:
+		return false
+	}
+	return q.IsActiveAt(now)
+}
+
+// PauseQueue pauses the running downloads of the queue until it is resumed or cleared.
+func (dm *DownloadManager) PauseQueue(queue *Queue) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.setQueueState(queue, QueuePaused)
+}
+
+// ResumeQueue runs the queue regardless of its window and resumes the
+// downloads that pausing it had paused.
+func (dm *DownloadManager) ResumeQueue(queue *Queue) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.setQueueState(queue, QueueRunning)
+}
+
+// DrainQueue lets the running downloads finish and starts no new ones.
+func (dm *DownloadManager) DrainQueue(queue *Queue) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.setQueueState(queue, QueueDraining)
+}
+
+// ClearQueueState returns the queue to its time window.
+func (dm *DownloadManager) ClearQueueState(queue *Queue) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.setQueueState(queue, "")
+}
+
+// setQueueState sets the manual state of the queue. Callers hold dm.mu.
+func (dm *DownloadManager) setQueueState(queue *Queue, state string) {
+	queue.State = state
+	queue.PausedByAll = false
+	if state == QueuePaused {
+		queue.IsActive = false
+		dm.stopDownloads(queue)
+	}
+	dm.notify(queue)
+}
+
+// PauseAll pauses every queue that is not paused yet.
+func (dm *DownloadManager) PauseAll() {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	for _, queue := range dm.Queues {
+		if !queue.IsRemoved && queue.State != QueuePaused {
+			dm.setQueueState(queue, QueuePaused)
+			queue.PausedByAll = true
+		}
+	}
+}
+
+// ResumeAll clears the pause of the queues PauseAll paused, which then follow
+// their window again. Queues paused on their own stay paused.
+func (dm *DownloadManager) ResumeAll() {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	for _, queue := range dm.Queues {
+		if queue.PausedByAll && queue.State == QueuePaused {
+			dm.setQueueState(queue, "")
+		}
+	}
+}
+
+// IsAllPaused reports whether every queue is paused.
+func (dm *DownloadManager) IsAllPaused() bool {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	paused := false
+	for _, queue := range dm.Queues {
+		if queue.IsRemoved {
+			continue
+		}
+		if queue.State != QueuePaused {
+			return false
+		}
+		paused = true
+	}
+	return paused
+}
+
+// resumePausedByQueue resumes the downloads paused because the queue stopped
+// running. Callers hold dm.mu.
+func (dm *DownloadManager) resumePausedByQueue(queue *Queue) {
+	for _, download := range queue.Downloads {
+		if download.PausedByQueue && download.Status == "paused" {
+			download.PausedByQueue = false
+			dm.resumeDownload(download)
+		}
+	}
+}
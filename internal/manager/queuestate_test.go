@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueueStates(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 512*1024)
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	// slow enough to be paused and drained while it runs
+	slow := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "slow.bin", URL: server.URL, MaxBandwidth: 64}
+	dm.AddDownload(slow)
+	waitForStatus(t, dm, slow, 5*time.Second, "downloading")
+
+	dm.PauseQueue(queue)
+	waitForStatus(t, dm, slow, 5*time.Second, "paused")
+	if !slow.PausedByQueue {
+		t.Fatal("the download is not marked as paused by its queue")
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if status := dm.Status(slow); status != "paused" {
+		t.Fatalf("download is %s in a paused queue", status)
+	}
+
+	dm.ResumeQueue(queue)
+	waitForStatus(t, dm, slow, 5*time.Second, "downloading")
+
+	dm.DrainQueue(queue)
+	next := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "next.bin", URL: server.URL}
+	dm.AddDownload(next)
+	dm.SetDownloadBandwidth(slow, 0)
+	waitForStatus(t, dm, slow, 10*time.Second, "finished")
+	time.Sleep(1500 * time.Millisecond)
+	if status := dm.Status(next); status != "pending" {
+		t.Fatalf("a draining queue started a new download, it is %s", status)
+	}
+
+	dm.ClearQueueState(queue)
+	waitForStatus(t, dm, next, 10*time.Second, "finished")
+	if got, _ := os.ReadFile(filepath.Join(queue.SaveDir, "slow.bin")); !bytes.Equal(got, content) {
+		t.Errorf("the paused and resumed download saved %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestPauseAll(t *testing.T) {
+	dm := newTestManager(t)
+	first, second := &Queue{ID: 1, MaxConcurrentDownloads: 1}, &Queue{ID: 2, MaxConcurrentDownloads: 1, State: QueueRunning}
+	third := &Queue{ID: 3, MaxConcurrentDownloads: 1}
+	for _, queue := range []*Queue{first, second, third} {
+		dm.AddQueue(queue)
+		defer dm.RemoveQueue(queue)
+	}
+	dm.PauseQueue(third) // paused on its own before
+
+	dm.PauseAll()
+	if !dm.IsAllPaused() || first.IsRunningAt(time.Now()) || second.IsRunningAt(time.Now()) {
+		t.Fatal("PauseAll left a queue running")
+	}
+	dm.ResumeAll()
+	if dm.IsAllPaused() || first.State != "" || second.State != "" {
+		t.Errorf("ResumeAll left the states %q and %q", first.State, second.State)
+	}
+	if third.State != QueuePaused {
+		t.Errorf("ResumeAll resumed a queue it had not paused, its state is %q", third.State)
+	}
+}
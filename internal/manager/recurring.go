@@ -0,0 +1,304 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultNameTemplate names the versions of a recurring download when it has no template.
+const DefaultNameTemplate = "{name}-{date}{ext}"
+
+// maxRecurringHistory bounds the runs kept per recurring download in the store.
+const maxRecurringHistory = 50
+
+// Results of a recurring download run.
+const (
+	RunDownloaded = "downloaded" // the remote changed and a new version was saved
+	RunUnchanged  = "unchanged"  // the server answered 304 Not Modified
+	RunFailed     = "failed"
+)
+
+// Recurring fetches the same URL again whenever its cron expression fires.
+type Recurring struct {
+	Queue        *Queue         `json:"-"`
+	IsRemoved    bool           `json:"-"`
+	schedule     *CronSchedule  `json:"-"`
+	wake         chan struct{}  `json:"-"` // set when it was removed or asked to run now
+	ID           int            `json:"id"`
+	QueueID      int            `json:"queue_id"`
+	URL          string         `json:"url"`
+	Cron         string         `json:"cron"`
+	NameTemplate string         `json:"name_template"`  // default {name}-{date}{ext}
+	KeepLast     int            `json:"keep_last"`      // default 0 to keep every version
+	ETag         string         `json:"etag,omitempty"` // validators of the last saved version
+	LastModified string         `json:"last_modified,omitempty"`
+	NextRun      time.Time      `json:"next_run"`
+	Versions     []string       `json:"versions"` // paths of the kept versions, oldest first
+	History      []RecurringRun `json:"history"`
+}
+
+// RecurringRun records one run of a recurring download.
+type RecurringRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Result     string    `json:"result"`
+	DownloadID int       `json:"download_id,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// LastRun returns the most recent run, or nil before the first one.
+func (r *Recurring) LastRun() *RecurringRun {
+	if len(r.History) == 0 {
+		return nil
+	}
+	return &r.History[len(r.History)-1]
+}
+
+func (r *Recurring) addRun(run RecurringRun) {
+	r.History = append(r.History, run)
+	if len(r.History) > maxRecurringHistory {
+		r.History = r.History[len(r.History)-maxRecurringHistory:]
+	}
+}
+
+// keepVersion adds a saved version and deletes the oldest ones beyond KeepLast.
+func (r *Recurring) keepVersion(path string) {
+	for i, version := range r.Versions {
+		if version == path { // overwritten in place, e.g. a template without {date}
+			r.Versions = append(r.Versions[:i], r.Versions[i+1:]...)
+			break
+		}
+	}
+	r.Versions = append(r.Versions, path)
+	for r.KeepLast > 0 && len(r.Versions) > r.KeepLast {
+		os.Remove(r.Versions[0])
+		r.Versions = r.Versions[1:]
+	}
+}
+
+// ExpandNameTemplate fills {name}, {ext}, {date} and {time} for a run at now.
+// A plain file name gets the date before its extension so versions do not collide.
+func ExpandNameTemplate(template, rawURL string, now time.Time) string {
+	if template == "" {
+		template = DefaultNameTemplate
+	} else if !strings.Contains(template, "{") {
+		ext := filepath.Ext(template)
+		template = strings.TrimSuffix(template, ext) + "-{date}" + ext
+	}
+	fileName, err := GetFileNameFromURL(rawURL)
+	if err != nil {
+		fileName = "download"
+	}
+	ext := filepath.Ext(fileName)
+	name := strings.NewReplacer(
+		"{name}", strings.TrimSuffix(fileName, ext),
+		"{ext}", ext,
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15-04-05"),
+	).Replace(template)
+	if name = sanitizeFileName(name); name == "" {
+		return fileName
+	}
+	return name
+}
+
+// AddRecurring starts following the cron expression of a recurring download.
+// Each run that finds a new version sends its download to RecurringDownloads.
+func (dm *DownloadManager) AddRecurring(recurring *Recurring) error {
+	schedule, err := ParseCron(recurring.Cron)
+	if err != nil {
+		return err
+	}
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	recurring.schedule = schedule
+	recurring.IsRemoved = false
+	recurring.wake = make(chan struct{}, 1)
+	if recurring.NextRun.IsZero() {
+		recurring.NextRun = schedule.Next(dm.Clock.Now())
+	}
+	go dm.followRecurring(recurring)
+	return nil
+}
+
+func (dm *DownloadManager) RemoveRecurring(recurring *Recurring) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	recurring.IsRemoved = true
+	recurring.notify()
+}
+
+// RunRecurringNow makes the recurring download run now instead of at its next cron time.
+func (dm *DownloadManager) RunRecurringNow(recurring *Recurring) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	recurring.NextRun = dm.Clock.Now()
+	recurring.notify()
+}
+
+// notify wakes the goroutine following the recurring download, a wake that
+// is already pending covers it.
+func (r *Recurring) notify() {
+	if r.wake == nil {
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// followRecurring runs the recurring download whenever its next cron time
+// passed, and sleeps until then or until it is removed or asked to run now.
+func (dm *DownloadManager) followRecurring(recurring *Recurring) {
+	for {
+		dm.mu.Lock()
+		if recurring.IsRemoved || dm.ctx.Err() != nil {
+			dm.mu.Unlock()
+			return
+		}
+		now := dm.Clock.Now()
+		nextRun := recurring.NextRun
+		dm.mu.Unlock()
+		if !nextRun.IsZero() && !now.Before(nextRun) {
+			// a run missed while gdm was closed happens once at startup
+			dm.runRecurring(recurring, now)
+			dm.mu.Lock()
+			if dm.ctx.Err() == nil { // a run cut by Shutdown happens again at startup
+				recurring.NextRun = recurring.schedule.Next(dm.Clock.Now())
+			}
+			dm.mu.Unlock()
+			continue
+		}
+		var due <-chan time.Time // nil when the cron expression never fires again
+		if !nextRun.IsZero() {
+			due = dm.Clock.After(nextRun.Sub(now))
+		}
+		select {
+		case <-due:
+		case <-recurring.wake:
+		case <-dm.ctx.Done():
+		}
+	}
+}
+
+func (dm *DownloadManager) runRecurring(recurring *Recurring, now time.Time) {
+	run := RecurringRun{StartedAt: now, Result: RunFailed}
+	defer func() {
+		dm.mu.Lock()
+		defer dm.mu.Unlock()
+		if dm.ctx.Err() != nil {
+			return
+		}
+		run.FinishedAt = dm.Clock.Now()
+		recurring.addRun(run)
+	}()
+
+	dm.mu.Lock()
+	queueRemoved := recurring.Queue == nil || recurring.Queue.IsRemoved
+	current := *recurring
+	client := dm.client()
+	dm.mu.Unlock()
+	if queueRemoved {
+		run.Error = "queue was removed"
+		return
+	}
+	changed, etag, lastModified, err := checkForUpdate(dm.ctx, client, &current)
+	if err != nil {
+		run.Error = classifyError(err).Error()
+		return
+	}
+	if !changed {
+		run.Result = RunUnchanged
+		return
+	}
+
+	download := &Download{
+		QueueID:     current.QueueID,
+		Queue:       current.Queue,
+		RecurringID: current.ID,
+		URL:         current.URL,
+		OutputFile:  ExpandNameTemplate(current.NameTemplate, current.URL, now),
+		Status:      "pending",
+	}
+	select {
+	case dm.RecurringDownloads <- download:
+	case <-dm.ctx.Done():
+		return
+	}
+	status := dm.waitForDownload(download)
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	run.DownloadID = download.ID
+	if status != "finished" {
+		run.Error = "download " + status
+		if download.LastError != "" {
+			run.Error += ": " + download.LastError
+		}
+		return
+	}
+	run.Result = RunDownloaded
+	run.Path = download.OutputPath
+	recurring.ETag, recurring.LastModified = etag, lastModified
+	recurring.keepVersion(download.OutputPath)
+}
+
+// waitForDownload waits until the download finished, failed or was removed.
+// Paused and conflicting downloads are waited for until the user acts.
+func (dm *DownloadManager) waitForDownload(download *Download) string {
+	for {
+		dm.mu.Lock()
+		removed, status := download.IsRemoved, download.Status
+		if dm.settled == nil {
+			dm.settled = make(chan struct{})
+		}
+		settled := dm.settled
+		dm.mu.Unlock()
+		if removed {
+			return "removed"
+		}
+		if status == "finished" || status == "failed" {
+			return status
+		}
+		select {
+		case <-settled:
+		case <-dm.ctx.Done():
+			return "stopped"
+		}
+	}
+}
+
+// checkForUpdate asks the server whether the URL changed since the last saved
+// version, using the validators that version was served with. It sends a
+// conditional GET for the first bytes, which servers refusing HEAD answer too.
+func checkForUpdate(ctx context.Context, client *http.Client, recurring *Recurring) (changed bool, etag, lastModified string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, recurring.URL, nil)
+	if err != nil {
+		return false, "", "", err
+	}
+	req.Header.Set("Range", "bytes=0-1")
+	if recurring.ETag != "" {
+		req.Header.Set("If-None-Match", recurring.ETag)
+	}
+	if recurring.LastModified != "" {
+		req.Header.Set("If-Modified-Since", recurring.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, "", "", err
+	}
+	discardBody(resp)
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, recurring.ETag, recurring.LastModified, nil
+	case http.StatusOK, http.StatusPartialContent:
+		return true, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), nil
+	}
+	return false, "", "", httpError(resp)
+}
@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecurringDownload(t *testing.T) {
+	var mu sync.Mutex
+	content, version := []byte("build 1"), "v1"
+	modTime := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body, etag, modified := content, version, modTime
+		mu.Unlock()
+		w.Header().Set("ETag", `"`+etag+`"`)
+		http.ServeContent(w, r, "nightly.bin", modified, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+
+	clock := &fakeClock{now: mustTime(t, "2026-10-19 01:00", "UTC")}
+	dm := newTestManager(t)
+	dm.Clock = clock
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	// stands in for the TUI, which gives the downloads their IDs
+	go func() {
+		for id := 1; ; id++ {
+			download := <-dm.RecurringDownloads
+			download.ID = id
+			dm.AddDownload(download)
+		}
+	}()
+
+	recurring := &Recurring{ID: 1, QueueID: 1, Queue: queue, URL: server.URL + "/nightly.bin",
+		Cron: "0 2 * * *", NameTemplate: "{name}-{date}{ext}", KeepLast: 1}
+	if err := dm.AddRecurring(recurring); err != nil {
+		t.Fatal(err)
+	}
+	defer dm.RemoveRecurring(recurring)
+
+	runs := func(n int, at string) *RecurringRun {
+		t.Helper()
+		clock.Set(mustTime(t, at, "UTC"))
+		deadline := time.Now().Add(5 * time.Second)
+		for len(dm.RecurringSnapshot(recurring).History) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("run %d did not happen", n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return dm.RecurringSnapshot(recurring).LastRun()
+	}
+
+	first := runs(1, "2026-10-19 02:00")
+	if first.Result != RunDownloaded || first.DownloadID != 1 {
+		t.Fatalf("first run = %+v, want a download", first)
+	}
+	if filepath.Base(first.Path) != "nightly-2026-10-19.bin" {
+		t.Errorf("first version saved as %s", first.Path)
+	}
+
+	if second := runs(2, "2026-10-20 02:00"); second.Result != RunUnchanged {
+		t.Fatalf("second run = %+v, want unchanged", second)
+	}
+
+	mu.Lock()
+	content, version, modTime = []byte("build 2"), "v2", modTime.Add(48*time.Hour)
+	mu.Unlock()
+	third := runs(3, "2026-10-21 02:00")
+	if third.Result != RunDownloaded {
+		t.Fatalf("third run = %+v, want a download", third)
+	}
+	if got, _ := os.ReadFile(third.Path); string(got) != "build 2" {
+		t.Errorf("third version holds %q", got)
+	}
+	if _, err := os.Stat(first.Path); !os.IsNotExist(err) {
+		t.Errorf("the first version was kept beyond KeepLast: %v", err)
+	}
+	if versions := dm.RecurringSnapshot(recurring).Versions; len(versions) != 1 || versions[0] != third.Path {
+		t.Errorf("versions = %v", versions)
+	}
+}
+
+func TestRecurringRunNow(t *testing.T) {
+	modTime := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead { // as presigned URLs signed for GET do
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "nightly.bin", modTime, bytes.NewReader([]byte("build 1")))
+	}))
+	t.Cleanup(server.Close)
+
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	go func() {
+		for id := 1; ; id++ {
+			download := <-dm.RecurringDownloads
+			download.ID = id
+			dm.AddDownload(download)
+		}
+	}()
+
+	// once a year, so only RunRecurringNow makes it run
+	recurring := &Recurring{ID: 1, QueueID: 1, Queue: queue, URL: server.URL + "/nightly.bin", Cron: "0 2 1 1 *"}
+	if err := dm.AddRecurring(recurring); err != nil {
+		t.Fatal(err)
+	}
+	defer dm.RemoveRecurring(recurring)
+
+	for i, want := range []string{RunDownloaded, RunUnchanged} {
+		dm.RunRecurringNow(recurring)
+		deadline := time.Now().Add(5 * time.Second)
+		for len(dm.RecurringSnapshot(recurring).History) <= i {
+			if time.Now().After(deadline) {
+				t.Fatalf("run %d did not happen", i+1)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if run := dm.RecurringSnapshot(recurring).LastRun(); run.Result != want {
+			t.Errorf("run %d = %+v, want %s", i+1, run, want)
+		}
+	}
+}
+
+func TestExpandNameTemplate(t *testing.T) {
+	now := mustTime(t, "2026-10-19 02:30", "UTC")
+	tests := []struct{ template, url, want string }{
+		{"", "http://example.com/dump.tar.gz", "dump.tar-2026-10-19.gz"},
+		{"{date}_{time}_{name}{ext}", "http://example.com/data.csv", "2026-10-19_02-30-00_data.csv"},
+		{"../{name}", "http://example.com/a.txt", "a"},
+		{"latest.iso", "http://example.com/a.iso", "latest-2026-10-19.iso"},
+		{"{name}{ext}", "http://example.com/", "download"},
+	}
+	for _, test := range tests {
+		if got := ExpandNameTemplate(test.template, test.url, now); got != test.want {
+			t.Errorf("ExpandNameTemplate(%q, %q) = %q, want %q", test.template, test.url, got, test.want)
+		}
+	}
+}
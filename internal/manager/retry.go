@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy sets how long a download waits before it tries again after a
+// transient error. The delay grows by Factor from BaseDelay up to MaxDelay,
+// and a random part of Jitter times the delay is added or taken off so that
+// downloads failing together do not retry together.
+type RetryPolicy struct {
+	BaseDelay time.Duration `json:"base_delay"`
+	Factor    float64       `json:"factor"`
+	MaxDelay  time.Duration `json:"max_delay"`
+	Jitter    float64       `json:"jitter"` // from 0 to 1
+}
+
+// DefaultRetryPolicy is used by the queues without a policy of their own.
+var DefaultRetryPolicy = RetryPolicy{BaseDelay: time.Second, Factor: 2, MaxDelay: time.Minute, Jitter: 0.2}
+
+// GetRetryPolicy returns the queue's retry policy, the default when it has none.
+func (q *Queue) GetRetryPolicy() RetryPolicy {
+	if q.RetryPolicy == nil {
+		return DefaultRetryPolicy
+	}
+	return *q.RetryPolicy
+}
+
+// Delay returns how long to wait before the given retry, counted from 1.
+// A Retry-After asked by the server is waited for even past MaxDelay.
+func (p RetryPolicy) Delay(retry int, retryAfter time.Duration) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(max(p.Factor, 1), float64(retry-1))
+	delay = min(delay, float64(p.MaxDelay))
+	delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	return max(time.Duration(delay), retryAfter)
+}
+
+// retryable reports whether the error may go away on its own, as timeouts,
+// dropped connections and server errors do. Errors such as a missing file, a
+// full disk or a file that changed on the server fail the download at once.
+func retryable(err error) bool {
+	classified := classifyError(err)
+	switch classified.Kind {
+	case ErrorHTTP:
+		switch classified.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+			return true
+		}
+		return classified.StatusCode >= 500
+	case ErrorTLS, ErrorDiskFull, ErrorPermission, ErrorRemoteChanged:
+		return false
+	}
+	return true
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// nextRetry counts a retry after err in retries, those of the download or of
+// one of its parts, and returns how long to wait before it, or false when err
+// is permanent or the queue's retries are used up. Callers hold dm.mu.
+func (dm *DownloadManager) nextRetry(download *Download, retries *int, err error) (time.Duration, bool) {
+	if !retryable(err) || *retries >= download.Queue.MaxRetries {
+		return 0, false
+	}
+	*retries++
+	var retryAfter time.Duration
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		retryAfter = downloadErr.RetryAfter
+	}
+	return download.Queue.GetRetryPolicy().Delay(*retries, retryAfter), true
+}
+
+// ParseRetryPolicy parses a policy written as "base xfactor max jitter%", for
+// example "1s x2 1m 20%". Fields left out keep their default, and an empty
+// spec gives nil for the default policy.
+func ParseRetryPolicy(spec string) (*RetryPolicy, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if len(fields) > 4 {
+		return nil, errors.New("use base xfactor max jitter%, as 1s x2 1m 20%")
+	}
+	policy := DefaultRetryPolicy
+	var err error
+	for i, field := range fields {
+		switch i {
+		case 0:
+			policy.BaseDelay, err = time.ParseDuration(field)
+			if err != nil || policy.BaseDelay <= 0 {
+				return nil, fmt.Errorf("invalid base delay %q", field)
+			}
+		case 1:
+			policy.Factor, err = strconv.ParseFloat(strings.TrimPrefix(field, "x"), 64)
+			if err != nil || policy.Factor < 1 {
+				return nil, fmt.Errorf("invalid factor %q, it is at least x1", field)
+			}
+		case 2:
+			policy.MaxDelay, err = time.ParseDuration(field)
+			if err != nil || policy.MaxDelay < policy.BaseDelay {
+				return nil, fmt.Errorf("invalid max delay %q, it is at least the base delay", field)
+			}
+		case 3:
+			percent, err := strconv.Atoi(strings.TrimSuffix(field, "%"))
+			if err != nil || percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("invalid jitter %q, it is from 0%% to 100%%", field)
+			}
+			policy.Jitter = float64(percent) / 100
+		}
+	}
+	if policy.MaxDelay < policy.BaseDelay {
+		policy.MaxDelay = policy.BaseDelay
+	}
+	return &policy, nil
+}
+
+// FormatRetryPolicy is the inverse of ParseRetryPolicy.
+func FormatRetryPolicy(policy *RetryPolicy) string {
+	if policy == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s x%s %s %d%%", policy.BaseDelay, strconv.FormatFloat(policy.Factor, 'f', -1, 64),
+		policy.MaxDelay, int(math.Round(policy.Jitter*100)))
+}
@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRetryPolicy(t *testing.T) {
+	policy, err := ParseRetryPolicy("500ms x3 30s 10%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RetryPolicy{BaseDelay: 500 * time.Millisecond, Factor: 3, MaxDelay: 30 * time.Second, Jitter: 0.1}
+	if *policy != want {
+		t.Errorf("parsed %+v, want %+v", *policy, want)
+	}
+	if spec := FormatRetryPolicy(policy); spec != "500ms x3 30s 10%" {
+		t.Errorf("formatted as %q", spec)
+	}
+	if policy, err := ParseRetryPolicy("2s"); err != nil || policy.Factor != DefaultRetryPolicy.Factor || policy.BaseDelay != 2*time.Second {
+		t.Errorf("a base delay alone gave %+v, %v", policy, err)
+	}
+	for _, spec := range []string{"soon", "1s x0.5", "10s x2 1s", "1s x2 1m 120%", "1s x2 1m 20% 5"} {
+		if _, err := ParseRetryPolicy(spec); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, Factor: 2, MaxDelay: 10 * time.Second, Jitter: 0.5}
+	for retry, base := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 6: 10 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if delay := policy.Delay(retry, 0); delay < base/2 || delay > base*3/2 {
+				t.Fatalf("retry %d waits %s, want %s give or take half", retry, delay, base)
+			}
+		}
+	}
+	if delay := policy.Delay(1, time.Minute); delay != time.Minute {
+		t.Errorf("waits %s with a Retry-After of 1m", delay)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	modTime := time.Now()
+	var mu sync.Mutex
+	var ranges []string
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			mu.Lock()
+			ranges = append(ranges, r.Method)
+			mu.Unlock()
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodHead || r.Header.Get("Range") == "bytes=0-1" {
+			http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+			return
+		}
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		times = append(times, time.Now())
+		attempt := len(ranges)
+		mu.Unlock()
+		switch attempt {
+		case 1: // drops the connection after a quarter of the file
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[:16*1024])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	dm := newTestManager(t)
+	queue := &Queue{
+		ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 3,
+		RetryPolicy: &RetryPolicy{BaseDelay: 10 * time.Millisecond, Factor: 1, MaxDelay: 10 * time.Millisecond},
+	}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL + "/file.bin"}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+
+	snapshot := dm.Snapshot(download)
+	if snapshot.Status != "finished" || snapshot.FinalSize != int64(len(content)) {
+		t.Fatalf("the download is %s with %d bytes: %s", snapshot.Status, snapshot.FinalSize, snapshot.LastError)
+	}
+	mu.Lock()
+	if len(ranges) != 3 || ranges[2] != fmt.Sprintf("bytes=%d-%d", 16*1024, len(content)-1) {
+		t.Errorf("the part asked for %q, want to go on from the 16 KB it had", ranges)
+	}
+	if len(times) == 3 && times[2].Sub(times[1]) < time.Second {
+		t.Errorf("retried %s after a Retry-After of 1s", times[2].Sub(times[1]))
+	}
+	ranges = nil
+	mu.Unlock()
+
+	missing := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "missing.bin", URL: server.URL + "/missing"}
+	dm.AddDownload(missing)
+	waitForStatus(t, dm, missing, 5*time.Second, "failed")
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ranges) != 1 {
+		t.Errorf("a 404 was asked %d times, it is not worth a retry", len(ranges))
+	}
+}
+
+func TestRetryParts(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 256*1024)
+	modTime := time.Now()
+	var mu sync.Mutex
+	broken := true
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Header.Get("Range")]++
+		fail := broken && strings.HasPrefix(r.Header.Get("Range"), "bytes=") && !strings.HasPrefix(r.Header.Get("Range"), "bytes=0-")
+		mu.Unlock()
+		if fail { // the second part keeps failing
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dm := newTestManager(t)
+	queue := &Queue{
+		ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 2,
+		RetryPolicy: &RetryPolicy{BaseDelay: time.Millisecond, Factor: 1, MaxDelay: time.Millisecond},
+	}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "failed")
+
+	snapshot := dm.Snapshot(download)
+	if len(snapshot.PartDownloaders) != 2 {
+		t.Fatalf("the download has %d parts, want 2", len(snapshot.PartDownloaders))
+	}
+	first, second := snapshot.PartDownloaders[0], snapshot.PartDownloaders[1]
+	if first.IsFailed || first.Start <= first.End {
+		t.Errorf("the first part stopped at %d of %d, failed %v", first.Start, first.End, first.IsFailed)
+	}
+	if !second.IsFailed || second.Retries != 2 || snapshot.Temps.Retries != 0 {
+		t.Errorf("the second part failed %v after %d retries, the download retried %d times",
+			second.IsFailed, second.Retries, snapshot.Temps.Retries)
+	}
+	if err := dm.RetryParts(download, 0); err == nil {
+		t.Error("retried a part that did not fail")
+	}
+
+	mu.Lock()
+	broken = false
+	firstRange := fmt.Sprintf("bytes=0-%d", first.End)
+	mu.Unlock()
+	if err := dm.RetryParts(download, 1); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, dm, download, 5*time.Second, "finished")
+	saved, err := os.ReadFile(dm.Snapshot(download).OutputPath)
+	if err != nil || !bytes.Equal(saved, content) {
+		t.Errorf("the saved file differs from the served one: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests[firstRange] != 1 {
+		t.Errorf("the first part was asked for %d times, want once", requests[firstRange])
+	}
+}
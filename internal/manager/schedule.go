@@ -0,0 +1,331 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BandwidthTier limits a queue's bandwidth during a daily time window
+type BandwidthTier struct {
+	Days         []time.Weekday `json:"days"`          // empty for every day
+	Start        string         `json:"start"`         // HH:MM
+	End          string         `json:"end"`           // HH:MM, before Start for windows that cross midnight
+	MaxBandwidth int            `json:"max_bandwidth"` // 0 for unlimited
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// WeeklySchedule lists the time ranges a queue is active in, per weekday
+type WeeklySchedule struct {
+	TimeZone   string           `json:"time_zone"`  // IANA name, empty for local time
+	Windows    []ScheduleWindow `json:"windows"`    // empty to use the queue's active hours
+	Exceptions []string         `json:"exceptions"` // 2006-01-02 dates the queue stays inactive
+}
+
+// ScheduleWindow is a daily time range on some weekdays
+type ScheduleWindow struct {
+	Days  []time.Weekday `json:"days"`  // empty for every day
+	Start string         `json:"start"` // HH:MM
+	End   string         `json:"end"`   // HH:MM, before Start for windows that cross midnight
+}
+
+// location returns the schedule's time zone, local time if it has none.
+func (schedule *WeeklySchedule) location() *time.Location {
+	if schedule == nil || schedule.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// isException reports whether a window starting on the given day is skipped.
+func (schedule *WeeklySchedule) isException(day time.Time) bool {
+	date := day.Format("2006-01-02")
+	for _, exception := range schedule.Exceptions {
+		if exception == date {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActiveAt reports whether the queue may download at the given time, by its
+// weekly schedule or, without one, by its active start and end time.
+func (queue *Queue) IsActiveAt(now time.Time) bool {
+	schedule := queue.Schedule
+	now = now.In(schedule.location())
+	if schedule == nil || len(schedule.Windows) == 0 {
+		if _, err := parseClock(queue.ActiveStartTime); err != nil {
+			return true
+		}
+		if _, err := parseClock(queue.ActiveEndTime); err != nil {
+			return true
+		}
+		startDay, ok := windowStart(now, nil, queue.ActiveStartTime, queue.ActiveEndTime)
+		return ok && (schedule == nil || !schedule.isException(startDay))
+	}
+	for _, window := range schedule.Windows {
+		startDay, ok := windowStart(now, window.Days, window.Start, window.End)
+		if ok && !schedule.isException(startDay) {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentBandwidth returns the bandwidth in effect at the given time and the
+// index of the tier that sets it, or -1 when the queue's MaxBandwidth applies.
+func (queue *Queue) CurrentBandwidth(now time.Time) (int, int) {
+	now = now.In(queue.Schedule.location())
+	for i, tier := range queue.BandwidthSchedule {
+		if isWithinWindow(now, tier.Days, tier.Start, tier.End) {
+			return tier.MaxBandwidth, i
+		}
+	}
+	return queue.MaxBandwidth, -1
+}
+
+// applyBandwidth updates the queue's limiter to the bandwidth in effect now.
+func (queue *Queue) applyBandwidth(now time.Time) {
+	if queue.limiter == nil {
+		queue.limiter = &bandwidthLimiter{}
+	}
+	bandwidth, _ := queue.CurrentBandwidth(now)
+	if queue.limiter.Limit() != bandwidth {
+		queue.limiter.SetLimit(bandwidth)
+	}
+}
+
+// isWithinWindow reports whether now is between start and end (both HH:MM and
+// inclusive to the minute) on one of the days. A window whose end is before
+// its start crosses midnight and belongs to the day it starts on.
+func isWithinWindow(now time.Time, days []time.Weekday, start, end string) bool {
+	_, ok := windowStart(now, days, start, end)
+	return ok
+}
+
+// windowStart is like isWithinWindow and also returns the day the matching
+// window started on, which is yesterday for the early part of an overnight window.
+func windowStart(now time.Time, days []time.Weekday, start, end string) (time.Time, bool) {
+	startMinute, err := parseClock(start)
+	if err != nil {
+		return now, false
+	}
+	endMinute, err := parseClock(end)
+	if err != nil {
+		return now, false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	today := now.Weekday()
+	if startMinute <= endMinute {
+		return now, hasDay(days, today) && startMinute <= minute && minute <= endMinute
+	}
+	if hasDay(days, today) && minute >= startMinute {
+		return now, true
+	}
+	yesterday := now.AddDate(0, 0, -1)
+	return yesterday, hasDay(days, yesterday.Weekday()) && minute <= endMinute
+}
+
+func hasDay(days []time.Weekday, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock returns the minutes since midnight of an HH:MM time.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseDays parses "mon-fri", "sat,sun", "mon,wed-fri" or "daily".
+func parseDays(spec string) ([]time.Weekday, error) {
+	if spec == "daily" || spec == "*" {
+		return nil, nil
+	}
+	var days []time.Weekday
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := parseWeekday(from)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = parseWeekday(to); err != nil {
+				return nil, err
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, weekday := range weekdayNames {
+		if len(name) >= 3 && strings.HasPrefix(name, weekday) {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", name)
+}
+
+func formatDays(days []time.Weekday) string {
+	if len(days) == 0 {
+		return "daily"
+	}
+	// write runs of three or more consecutive days as ranges
+	var names []string
+	for i := 0; i < len(days); {
+		j := i
+		for j+1 < len(days) && days[j+1] == (days[j]+1)%7 {
+			j++
+		}
+		if j-i >= 2 {
+			names = append(names, weekdayNames[days[i]]+"-"+weekdayNames[days[j]])
+		} else {
+			for _, day := range days[i : j+1] {
+				names = append(names, weekdayNames[day])
+			}
+		}
+		i = j + 1
+	}
+	return strings.Join(names, ",")
+}
+
+// parseWindow parses "[days] HH:MM-HH:MM" and returns the remaining fields.
+func parseWindow(fields []string) ([]time.Weekday, string, string, []string, error) {
+	if len(fields) == 0 {
+		return nil, "", "", nil, errors.New("missing time window")
+	}
+	var days []time.Weekday
+	if !strings.Contains(fields[0], ":") {
+		var err error
+		if days, err = parseDays(fields[0]); err != nil {
+			return nil, "", "", nil, err
+		}
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, "", "", nil, errors.New("missing time window")
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return nil, "", "", nil, fmt.Errorf("invalid time window %q", fields[0])
+	}
+	if _, err := parseClock(start); err != nil {
+		return nil, "", "", nil, fmt.Errorf("invalid time %q", start)
+	}
+	if _, err := parseClock(end); err != nil {
+		return nil, "", "", nil, fmt.Errorf("invalid time %q", end)
+	}
+	return days, start, end, fields[1:], nil
+}
+
+// ParseBandwidthSchedule parses tiers separated by ";", each written as
+// "[days] HH:MM-HH:MM KB/s", for example "mon-fri 09:00-18:00 200; daily 00:00-23:59 0".
+func ParseBandwidthSchedule(spec string) ([]BandwidthTier, error) {
+	var tiers []BandwidthTier
+	for _, tierSpec := range strings.Split(spec, ";") {
+		fields := strings.Fields(tierSpec)
+		if len(fields) == 0 {
+			continue
+		}
+		days, start, end, rest, err := parseWindow(fields)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) != 1 {
+			return nil, fmt.Errorf("tier %q needs one bandwidth", strings.TrimSpace(tierSpec))
+		}
+		bandwidth, err := strconv.Atoi(rest[0])
+		if err != nil || bandwidth < 0 {
+			return nil, fmt.Errorf("invalid bandwidth %q", rest[0])
+		}
+		tiers = append(tiers, BandwidthTier{Days: days, Start: start, End: end, MaxBandwidth: bandwidth})
+	}
+	return tiers, nil
+}
+
+// FormatBandwidthSchedule is the inverse of ParseBandwidthSchedule.
+func FormatBandwidthSchedule(tiers []BandwidthTier) string {
+	specs := make([]string, len(tiers))
+	for i, tier := range tiers {
+		specs[i] = fmt.Sprintf("%s %s-%s %d", formatDays(tier.Days), tier.Start, tier.End, tier.MaxBandwidth)
+	}
+	return strings.Join(specs, "; ")
+}
+
+// ParseWeeklySchedule builds a schedule from windows separated by ";", each
+// written as "[days] HH:MM-HH:MM", an IANA time zone and exception dates
+// separated by ",". It returns nil when all of them are empty.
+func ParseWeeklySchedule(windows, timeZone, exceptions string) (*WeeklySchedule, error) {
+	schedule := &WeeklySchedule{TimeZone: strings.TrimSpace(timeZone)}
+	if schedule.TimeZone != "" {
+		if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", schedule.TimeZone)
+		}
+	}
+	for _, windowSpec := range strings.Split(windows, ";") {
+		fields := strings.Fields(windowSpec)
+		if len(fields) == 0 {
+			continue
+		}
+		days, start, end, rest, err := parseWindow(fields)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) != 0 {
+			return nil, fmt.Errorf("unexpected %q in window", strings.Join(rest, " "))
+		}
+		schedule.Windows = append(schedule.Windows, ScheduleWindow{Days: days, Start: start, End: end})
+	}
+	for _, exception := range strings.Split(exceptions, ",") {
+		exception = strings.TrimSpace(exception)
+		if exception == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", exception); err != nil {
+			return nil, fmt.Errorf("invalid date %q", exception)
+		}
+		schedule.Exceptions = append(schedule.Exceptions, exception)
+	}
+	if schedule.TimeZone == "" && len(schedule.Windows) == 0 && len(schedule.Exceptions) == 0 {
+		return nil, nil
+	}
+	return schedule, nil
+}
+
+// FormatScheduleWindows is the inverse of ParseWeeklySchedule for the windows.
+func FormatScheduleWindows(schedule *WeeklySchedule) string {
+	if schedule == nil {
+		return ""
+	}
+	specs := make([]string, len(schedule.Windows))
+	for i, window := range schedule.Windows {
+		specs[i] = fmt.Sprintf("%s %s-%s", formatDays(window.Days), window.Start, window.End)
+	}
+	return strings.Join(specs, "; ")
+}
@@ -0,0 +1,218 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCurrentBandwidth(t *testing.T) {
+	tiers, err := ParseBandwidthSchedule("mon-fri 09:00-18:00 200; fri 22:00-06:00 50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc, _ := ParseWeeklySchedule("daily 00:00-23:59", "UTC", "") // the tiers are in the schedule's zone
+	queue := &Queue{MaxBandwidth: 0, BandwidthSchedule: tiers, Schedule: utc}
+	cases := []struct {
+		time      string
+		bandwidth int
+		tier      int
+	}{
+		{"2026-10-19 09:00", 200, 0}, // Monday
+		{"2026-10-19 18:00", 200, 0},
+		{"2026-10-19 18:01", 0, -1},
+		{"2026-10-23 23:30", 50, 1}, // Friday night
+		{"2026-10-24 05:59", 50, 1}, // Saturday morning, still Friday's window
+		{"2026-10-24 09:30", 0, -1},
+		{"2026-10-25 23:30", 0, -1}, // Sunday night
+	}
+	for _, c := range cases {
+		now, _ := time.Parse("2006-01-02 15:04", c.time)
+		bandwidth, tier := queue.CurrentBandwidth(now)
+		if bandwidth != c.bandwidth || tier != c.tier {
+			t.Errorf("at %s got %d KB/s from tier %d, want %d from tier %d", c.time, bandwidth, tier, c.bandwidth, c.tier)
+		}
+	}
+}
+
+func TestParseBandwidthSchedule(t *testing.T) {
+	spec := "mon,wed-fri 09:00-18:00 200; daily 23:00-01:00 0"
+	tiers, err := ParseBandwidthSchedule(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := FormatBandwidthSchedule(tiers), "mon,wed-fri 09:00-18:00 200; daily 23:00-01:00 0"; got != want {
+		t.Errorf("FormatBandwidthSchedule = %q, want %q", got, want)
+	}
+	for _, invalid := range []string{"09:00 200", "mon-fri 09:00-25:00 100", "xyz 09:00-10:00 1", "09:00-10:00"} {
+		if _, err := ParseBandwidthSchedule(invalid); err == nil {
+			t.Errorf("ParseBandwidthSchedule(%q) should fail", invalid)
+		}
+	}
+}
+
+// fakeClock stays at the time it is set to and fires a timer once Set moves
+// the time to or past it, so the scheduler can be tested without waiting on
+// real time.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- now
+	}
+	c.timers = pending
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func mustTime(t *testing.T, value, zone string) time.Time {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return now
+}
+
+func TestWeeklySchedule(t *testing.T) {
+	schedule, err := ParseWeeklySchedule("mon-fri 09:00-17:00; sat 22:00-06:00", "Asia/Tehran", "2026-10-21, 2026-10-24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := &Queue{Schedule: schedule}
+	cases := []struct {
+		time   string
+		zone   string
+		active bool
+	}{
+		{"2026-10-19 09:00", "Asia/Tehran", true}, // Monday
+		{"2026-10-19 17:01", "Asia/Tehran", false},
+		{"2026-10-19 06:00", "UTC", true},          // 09:30 in Tehran
+		{"2026-10-21 10:00", "Asia/Tehran", false}, // exception date
+		{"2026-10-31 23:00", "Asia/Tehran", true},  // Saturday night
+		{"2026-11-01 05:30", "Asia/Tehran", true},  // Sunday morning, Saturday's window
+		{"2026-11-01 22:30", "Asia/Tehran", false}, // Sunday night
+		{"2026-10-25 02:00", "Asia/Tehran", false}, // window started on an exception date
+	}
+	for _, c := range cases {
+		if got := queue.IsActiveAt(mustTime(t, c.time, c.zone)); got != c.active {
+			t.Errorf("IsActiveAt(%s %s) = %v, want %v", c.time, c.zone, got, c.active)
+		}
+	}
+
+	overnight := &Queue{ActiveStartTime: "22:00", ActiveEndTime: "06:00"}
+	if !overnight.IsActiveAt(mustTime(t, "2026-10-19 23:00", "Local")) || !overnight.IsActiveAt(mustTime(t, "2026-10-19 05:00", "Local")) {
+		t.Error("a 22:00-06:00 window should be active at night")
+	}
+	if overnight.IsActiveAt(mustTime(t, "2026-10-19 12:00", "Local")) {
+		t.Error("a 22:00-06:00 window should not be active at noon")
+	}
+}
+
+func TestSchedulerFollowsClock(t *testing.T) {
+	server := newTestFileServer(t, []byte("scheduled"), time.Now())
+	clock := &fakeClock{now: mustTime(t, "2026-10-19 08:00", "UTC")}
+	dm := newTestManager(t)
+	dm.Clock = clock
+
+	schedule, _ := ParseWeeklySchedule("mon 09:00-10:00", "UTC", "")
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1, Schedule: schedule}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.txt", URL: server.URL}
+	dm.AddDownload(download)
+
+	time.Sleep(100 * time.Millisecond)
+	if status := dm.Status(download); status != "pending" {
+		t.Fatalf("download is %s before its queue's window", status)
+	}
+	clock.Set(mustTime(t, "2026-10-19 09:00", "UTC"))
+	waitForStatus(t, dm, download, 5*time.Second, "finished")
+}
+
+func TestBandwidthTiersFollowClock(t *testing.T) {
+	clock := &fakeClock{now: mustTime(t, "2026-10-18 09:30", "UTC")} // a Sunday
+	dm := newTestManager(t)
+	dm.Clock = clock
+
+	tiers, _ := ParseBandwidthSchedule("sun 09:00-10:00 200")
+	schedule, _ := ParseWeeklySchedule("daily 00:00-23:59", "UTC", "")
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxBandwidth: 50, BandwidthSchedule: tiers, Schedule: schedule}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	if limit := queue.limiter.Limit(); limit != 200 {
+		t.Errorf("the added queue is limited to %d KB/s, want the tier of the clock's time", limit)
+	}
+
+	tiers, _ = ParseBandwidthSchedule("sun 09:00-10:00 300")
+	dm.UpdateQueue(queue, func(queue *Queue) { queue.SetBandwidthSchedule(tiers) })
+	if limit := queue.limiter.Limit(); limit != 300 {
+		t.Errorf("the updated queue is limited to %d KB/s, want the new tier", limit)
+	}
+}
+
+func TestDownloadStartAndStopAt(t *testing.T) {
+	server := newTestFileServer(t, []byte("one-shot"), time.Now())
+	clock := &fakeClock{now: mustTime(t, "2026-10-19 08:00", "UTC")}
+	dm := newTestManager(t)
+	dm.Clock = clock
+
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	delayed := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "delayed.txt", URL: server.URL,
+		StartAt: mustTime(t, "2026-10-19 09:30", "UTC")}
+	expired := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "expired.txt", URL: server.URL,
+		StopAt: mustTime(t, "2026-10-19 07:00", "UTC")}
+	dm.AddDownload(delayed)
+	dm.AddDownload(expired)
+
+	waitForStatus(t, dm, expired, 5*time.Second, "paused")
+	if status := dm.Status(delayed); status != "pending" {
+		t.Fatalf("download is %s before its start time", status)
+	}
+	clock.Set(mustTime(t, "2026-10-19 09:30", "UTC"))
+	waitForStatus(t, dm, delayed, 5*time.Second, "finished")
+
+	dm.ResumeDownload(expired)
+	if !expired.StopAt.IsZero() {
+		t.Fatal("resuming after the stop time did not clear it")
+	}
+	waitForStatus(t, dm, expired, 5*time.Second, "finished")
+}
@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"errors"
+	"time"
+)
+
+// runScheduler starts the queue's downloads whenever something may have
+// changed what can start: a download became pending, finished or was paused,
+// a worker became free, the queue was edited, or a minute boundary or a start
+// or stop time of a download passed. It sleeps in between.
+func (dm *DownloadManager) runScheduler(queue *Queue) {
+	for {
+		dm.mu.Lock()
+		if queue.IsRemoved || dm.ctx.Err() != nil {
+			dm.mu.Unlock()
+			return
+		}
+		now := dm.Clock.Now()
+		dm.schedule(queue, now)
+		next := dm.nextCheck(queue, now)
+		dm.mu.Unlock()
+		select {
+		case <-queue.wake:
+		case <-dm.Clock.After(next):
+		case <-dm.ctx.Done():
+		}
+	}
+}
+
+// schedule updates whether the queue runs and starts the downloads that fit
+// in its free workers, in scheduling order. Callers hold dm.mu.
+func (dm *DownloadManager) schedule(queue *Queue, now time.Time) {
+	if !queue.IsRunningAt(now) {
+		queue.IsActive = false
+		dm.stopDownloads(queue)
+		return
+	}
+	queue.IsActive = true
+	dm.stopDownloads(queue) // past their stop time
+	if queue.State == QueueDraining {
+		return
+	}
+	dm.resumePausedByQueue(queue)
+	for !queue.IsRemoved {
+		download := dm.nextPending(queue, now)
+		if download == nil {
+			return
+		}
+		// the next download keeps its place until enough workers are free, all
+		// of them when it has more parts than the queue has workers
+		free := queue.workers.free()
+		needed := min(len(download.PartDownloaders), queue.workers.capacity())
+		if free == 0 || !queue.StartAtOneWorkerAvailable && free < needed {
+			return
+		}
+		if err := dm.checkDiskSpace(download); err != nil {
+			dm.pauseForSpace(download, err)
+			continue
+		}
+		dm.startDownload(download)
+	}
+}
+
+// stopDownloads stops the parts of the queue's downloads that have to stop.
+// Callers hold dm.mu.
+func (dm *DownloadManager) stopDownloads(queue *Queue) {
+	for _, download := range queue.Downloads {
+		if dm.shouldStop(download) {
+			dm.stopParts(download)
+		}
+	}
+}
+
+// nextPending returns the first download in scheduling order that may start
+// now. Downloads that are still initializing are passed over, they wake the
+// scheduler when they are ready.
+func (dm *DownloadManager) nextPending(queue *Queue, now time.Time) *Download {
+	if dm.isWaitingForQueue(queue) {
+		return nil
+	}
+	for _, download := range queue.OrderedDownloads() {
+		if download.Status != "pending" {
+			continue
+		}
+		if download.IsWaitingToStart(now) {
+			continue
+		}
+		if download.IsPastStop(now) {
+			download.Status = "paused"
+			continue
+		}
+		if download.GetDependencyPolicy() == DependencyCascade && dm.hasFailedDependency(download) {
+			dm.fail(download, errors.New("a download it depends on failed"))
+			continue
+		}
+		if len(dm.waitingFor(download)) > 0 {
+			continue
+		}
+		return download
+	}
+	return nil
+}
+
+// nextCheck returns how long the scheduler may sleep when nothing wakes it:
+// until the next minute, when active hours start or end, or until the next
+// start or stop time of one of its downloads if that comes first.
+func (dm *DownloadManager) nextCheck(queue *Queue, now time.Time) time.Duration {
+	next := untilNextMinute(now)
+	for _, download := range queue.Downloads {
+		for _, at := range []time.Time{download.StartAt, download.StopAt} {
+			if at.After(now) && at.Sub(now) < next {
+				next = at.Sub(now)
+			}
+		}
+	}
+	return next
+}
+
+func untilNextMinute(now time.Time) time.Duration {
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+// notify wakes the queue's scheduler, a wake that is already pending covers it.
+func (dm *DownloadManager) notify(queue *Queue) {
+	if queue == nil || queue.wake == nil {
+		return
+	}
+	select {
+	case queue.wake <- struct{}{}:
+	default:
+	}
+}
+
+// notifyAll wakes every scheduler, for changes other queues may wait for such
+// as a finished download they depend on, and the runs of recurring downloads
+// waiting for their download.
+func (dm *DownloadManager) notifyAll() {
+	for _, queue := range dm.Queues {
+		dm.notify(queue)
+	}
+	if dm.settled != nil {
+		close(dm.settled)
+		dm.settled = nil
+	}
+}
+
+// UpdateQueue edits the settings of a queue, such as its number of workers
+// and active hours, and applies them.
+func (dm *DownloadManager) UpdateQueue(queue *Queue, edit func(*Queue)) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	edit(queue)
+	queue.applyBandwidth(dm.Clock.Now())
+	queue.workers.setSize(max(1, queue.MaxConcurrentDownloads))
+	dm.notify(queue)
+}
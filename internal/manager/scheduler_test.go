@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInitializingDownloadDoesNotBlockQueue(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 16*1024)
+	release := make(chan struct{})
+	modTime := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stuck" {
+			<-release
+		}
+		http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	stuck := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "stuck.bin", URL: server.URL + "/stuck"}
+	next := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "next.bin", URL: server.URL + "/next"}
+	dm.AddDownload(stuck)
+	dm.AddDownload(next)
+	waitForStatus(t, dm, next, 3*time.Second, "finished")
+	if status := dm.Status(stuck); status != "initializing" {
+		t.Fatalf("the first download is %s, want initializing", status)
+	}
+	close(release)
+	waitForStatus(t, dm, stuck, 5*time.Second, "finished")
+}
+
+func TestSchedulerManyDownloads(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 1024)
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 8, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	downloads := make([]*Download, 300)
+	for i := range downloads {
+		downloads[i] = &Download{
+			ID: i + 1, QueueID: 1, Queue: queue, Status: "pending",
+			OutputFile: fmt.Sprintf("file%d.bin", i), URL: server.URL,
+		}
+		dm.AddDownload(downloads[i])
+	}
+	for _, download := range downloads {
+		waitForStatus(t, dm, download, 20*time.Second, "finished")
+	}
+}
+
+func TestMorePartsThanWorkers(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4*1024*1024+512*1024) // 4 parts
+	server := newTestFileServer(t, content, time.Now())
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 2, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+
+	large := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "large.bin", URL: server.URL}
+	dm.AddDownload(large)
+	behind := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "behind.bin", URL: server.URL}
+	dm.AddDownload(behind)
+	waitForStatus(t, dm, large, 10*time.Second, "finished")
+	if parts := len(dm.Snapshot(large).PartDownloaders); parts != 4 {
+		t.Errorf("the download has %d parts, want 4", parts)
+	}
+	waitForStatus(t, dm, behind, 10*time.Second, "finished")
+}
+
+func TestWorkerPool(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	idle := make(chan struct{}, 16)
+	pool := newWorkerPool(2, func() { idle <- struct{}{} })
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		pool.submit(func() {
+			defer wg.Done()
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	if free := pool.free(); free != 0 {
+		t.Errorf("free() = %d with every worker busy", free)
+	}
+	pool.setSize(3)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i := 0; i < 3; i++ {
+		<-idle
+	}
+
+	if maxRunning != 3 {
+		t.Errorf("%d jobs ran at once, want the 3 workers of the resized pool", maxRunning)
+	}
+	if free := pool.free(); free != 3 {
+		t.Errorf("free() = %d after all jobs finished, want 3", free)
+	}
+}
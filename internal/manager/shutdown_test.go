@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitForConnections waits until the parts hold n connections.
+func waitForConnections(t *testing.T, dm *DownloadManager, n int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for dm.OpenConnections() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections are open, want %d", dm.OpenConnections(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPauseInterruptsStalledRead(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	modTime := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || r.Header.Get("Range") == "bytes=0-1" {
+			http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+			return
+		}
+		// sends a little and then stalls until the client goes away
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[:1024])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	dm := newTestManager(t)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(queue)
+	defer dm.RemoveQueue(queue)
+	download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+	dm.AddDownload(download)
+	waitForStatus(t, dm, download, 5*time.Second, "downloading")
+	waitForConnections(t, dm, 1, 5*time.Second)
+
+	dm.PauseDownload(download)
+	waitForConnections(t, dm, 0, 500*time.Millisecond)
+	if part := dm.Snapshot(download).PartDownloaders[0]; part.Downloaded != 1024 {
+		t.Errorf("the part kept %d bytes, want the 1024 received", part.Downloaded)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("HOME", config)
+	content := bytes.Repeat([]byte("x"), 512*1024)
+	server := newTestFileServer(t, content, time.Now())
+
+	dm := newTestManager(t)
+	data := LoadData()
+	dm.UseStore(data)
+	queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1}
+	dm.AddQueue(queue)
+	data.AddQueue(queue)
+	running := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "running.bin", URL: server.URL, MaxBandwidth: 32}
+	paused := &Download{ID: 2, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "paused.bin", URL: server.URL, MaxBandwidth: 32}
+	for _, download := range []*Download{running, paused} {
+		data.AddDownload(download)
+		dm.AddDownload(download)
+		waitForStatus(t, dm, download, 5*time.Second, "downloading")
+	}
+	time.Sleep(300 * time.Millisecond)
+	dm.PauseDownload(paused)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := dm.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if n := dm.OpenConnections(); n != 0 {
+		t.Errorf("%d connections are still open", n)
+	}
+
+	saved := LoadData().Downloads
+	if status := saved["1"].Status; status != "pending" {
+		t.Errorf("the running download was saved as %s, want pending to go on at the next start", status)
+	}
+	if status := saved["2"].Status; status != "paused" {
+		t.Errorf("the paused download was saved as %s", status)
+	}
+	for _, part := range dm.Snapshot(running).PartDownloaders {
+		if size := getFileSize(part.TempFile); size != part.Downloaded || size == 0 {
+			t.Errorf("part %d holds %d bytes, %d were downloaded", part.Index, size, part.Downloaded)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package manager
+
+import "slices"
+
+// Snapshot returns a copy of the download that stays as it is while the
+// manager goes on, for showing or saving it. Its queue is a snapshot too.
+func (dm *DownloadManager) Snapshot(download *Download) *Download {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return download.snapshot()
+}
+
+// QueueSnapshot returns a copy of the queue without its downloads.
+func (dm *DownloadManager) QueueSnapshot(queue *Queue) *Queue {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return queue.snapshot()
+}
+
+// RecurringSnapshot returns a copy of the recurring download and its history.
+func (dm *DownloadManager) RecurringSnapshot(recurring *Recurring) *Recurring {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	copied := *recurring
+	copied.Versions = slices.Clone(recurring.Versions)
+	copied.History = slices.Clone(recurring.History)
+	if recurring.Queue != nil {
+		copied.Queue = recurring.Queue.snapshot()
+	}
+	return &copied
+}
+
+// Status returns the current status of the download.
+func (dm *DownloadManager) Status(download *Download) string {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return download.Status
+}
+
+// snapshot copies the download with its parts and queue. Callers hold dm.mu.
+func (d *Download) snapshot() *Download {
+	copied := *d
+	if d.Temps != nil {
+		temps := *d.Temps
+		copied.Temps = &temps
+	}
+	copied.PartDownloaders = make([]*PartDownloader, len(d.PartDownloaders))
+	for i, part := range d.PartDownloaders {
+		p := *part
+		copied.PartDownloaders[i] = &p
+	}
+	copied.DependsOn = slices.Clone(d.DependsOn)
+	if d.Queue != nil {
+		copied.Queue = d.Queue.snapshot()
+	}
+	return &copied
+}
+
+// snapshot copies the queue without its downloads. Callers hold dm.mu.
+func (q *Queue) snapshot() *Queue {
+	copied := *q
+	copied.Downloads = nil
+	copied.BandwidthSchedule = slices.Clone(q.BandwidthSchedule)
+	if q.Schedule != nil {
+		schedule := *q.Schedule
+		schedule.Windows = slices.Clone(q.Schedule.Windows)
+		schedule.Exceptions = slices.Clone(q.Schedule.Exceptions)
+		copied.Schedule = &schedule
+	}
+	if q.RetryPolicy != nil {
+		policy := *q.RetryPolicy
+		copied.RetryPolicy = &policy
+	}
+	return &copied
+}
@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeouts bound each step of a request, so that a server that stops
+// answering is retried instead of holding a part forever.
+type Timeouts struct {
+	Connect        time.Duration `json:"connect"`
+	TLSHandshake   time.Duration `json:"tls_handshake"`
+	ResponseHeader time.Duration `json:"response_header"`
+	IdleRead       time.Duration `json:"idle_read"`   // longest wait for the next bytes of the body
+	StallSpeed     int           `json:"stall_speed"` // KB/s a part must keep over StallTime, 0 to not check
+	StallTime      time.Duration `json:"stall_time"`
+}
+
+// DefaultTimeouts are used until SetTimeouts is called.
+var DefaultTimeouts = Timeouts{
+	Connect:        30 * time.Second,
+	TLSHandshake:   15 * time.Second,
+	ResponseHeader: 30 * time.Second,
+	IdleRead:       time.Minute,
+	StallSpeed:     1,
+	StallTime:      time.Minute,
+}
+
+// SetTimeouts changes the timeouts of the requests made from now on. Zero
+// durations keep their default.
+func (dm *DownloadManager) SetTimeouts(timeouts Timeouts) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	for _, field := range []struct{ value, fallback *time.Duration }{
+		{&timeouts.Connect, &DefaultTimeouts.Connect},
+		{&timeouts.TLSHandshake, &DefaultTimeouts.TLSHandshake},
+		{&timeouts.ResponseHeader, &DefaultTimeouts.ResponseHeader},
+		{&timeouts.IdleRead, &DefaultTimeouts.IdleRead},
+		{&timeouts.StallTime, &DefaultTimeouts.StallTime},
+	} {
+		if *field.value <= 0 {
+			*field.value = *field.fallback
+		}
+	}
+	timeouts.StallSpeed = max(0, timeouts.StallSpeed)
+	dm.Timeouts = timeouts
+	dm.rebuildTransport()
+}
+
+// errStalled cancels a request whose body stopped coming or came too slowly.
+var errStalled = errors.New("stalled")
+
+// stallWatch cancels a request when a read waits longer than the idle read
+// timeout, and tells when the body comes slower than the stall speed. Only the
+// time spent in reads counts, so a bandwidth limit does not look like a stall.
+type stallWatch struct {
+	timeouts Timeouts
+	idle     *time.Timer
+	since    time.Duration // time spent in reads since the window started
+	received int64
+}
+
+func newStallWatch(timeouts Timeouts, cancel context.CancelCauseFunc) *stallWatch {
+	idle := time.AfterFunc(timeouts.IdleRead, func() { cancel(errStalled) })
+	idle.Stop()
+	return &stallWatch{timeouts: timeouts, idle: idle}
+}
+
+// read calls read with the idle timeout running.
+func (w *stallWatch) read(read func() (int, error)) (int, error) {
+	start := time.Now()
+	w.idle.Reset(w.timeouts.IdleRead)
+	n, err := read()
+	w.idle.Stop()
+	w.since += time.Since(start)
+	w.received += int64(n)
+	return n, err
+}
+
+// stalled reports whether the last stall window came slower than the stall
+// speed, and starts a new window once one is over.
+func (w *stallWatch) stalled() error {
+	if w.timeouts.StallSpeed == 0 || w.since < w.timeouts.StallTime {
+		return nil
+	}
+	slow := float64(w.received) < float64(w.timeouts.StallSpeed)*1024*w.since.Seconds()
+	w.since, w.received = 0, 0
+	if slow {
+		return &DownloadError{Kind: ErrorStalled, Detail: fmt.Sprintf("below %d KB/s for %s", w.timeouts.StallSpeed, w.timeouts.StallTime)}
+	}
+	return nil
+}
+
+func (w *stallWatch) stop() {
+	w.idle.Stop()
+}
+
+// ParseTimeouts parses timeouts written as "connect tls header idle stall-speed
+// stall-time", for example "30s 15s 30s 1m 1 1m". Fields left out keep their default.
+func ParseTimeouts(spec string) (Timeouts, error) {
+	timeouts := DefaultTimeouts
+	fields := strings.Fields(spec)
+	if len(fields) > 6 {
+		return timeouts, errors.New("use connect tls header idle KB/s stall-time, as 30s 15s 30s 1m 1 1m")
+	}
+	durations := []*time.Duration{&timeouts.Connect, &timeouts.TLSHandshake, &timeouts.ResponseHeader, &timeouts.IdleRead}
+	for i, field := range fields {
+		switch {
+		case i < len(durations):
+			duration, err := time.ParseDuration(field)
+			if err != nil || duration <= 0 {
+				return timeouts, fmt.Errorf("invalid timeout %q", field)
+			}
+			*durations[i] = duration
+		case i == 4:
+			speed, err := strconv.Atoi(field)
+			if err != nil || speed < 0 {
+				return timeouts, fmt.Errorf("invalid stall speed %q", field)
+			}
+			timeouts.StallSpeed = speed
+		default:
+			duration, err := time.ParseDuration(field)
+			if err != nil || duration <= 0 {
+				return timeouts, fmt.Errorf("invalid stall time %q", field)
+			}
+			timeouts.StallTime = duration
+		}
+	}
+	return timeouts, nil
+}
+
+// FormatTimeouts is the inverse of ParseTimeouts.
+func FormatTimeouts(timeouts Timeouts) string {
+	return fmt.Sprintf("%s %s %s %s %d %s", timeouts.Connect, timeouts.TLSHandshake, timeouts.ResponseHeader,
+		timeouts.IdleRead, timeouts.StallSpeed, timeouts.StallTime)
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	timeouts, err := ParseTimeouts("5s 2s 10s 30s 4 20s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Timeouts{Connect: 5 * time.Second, TLSHandshake: 2 * time.Second, ResponseHeader: 10 * time.Second,
+		IdleRead: 30 * time.Second, StallSpeed: 4, StallTime: 20 * time.Second}
+	if timeouts != want {
+		t.Errorf("parsed %+v, want %+v", timeouts, want)
+	}
+	if again, err := ParseTimeouts(FormatTimeouts(timeouts)); err != nil || again != timeouts {
+		t.Errorf("formatted as %q, parsed back as %+v", FormatTimeouts(timeouts), again)
+	}
+	if timeouts, err := ParseTimeouts("5s"); err != nil || timeouts.IdleRead != DefaultTimeouts.IdleRead {
+		t.Errorf("a connect timeout alone gave %+v, %v", timeouts, err)
+	}
+	for _, spec := range []string{"soon", "5s 2s 10s 30s fast", "5s 2s 10s 30s 4 20s 1"} {
+		if _, err := ParseTimeouts(spec); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
+
+func TestStalledPartIsRetried(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	modTime := time.Now()
+	tests := []struct {
+		name  string
+		first func(w http.ResponseWriter, r *http.Request) // serves the first request of the part
+	}{
+		{"silent body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[:1024])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}},
+		{"slow body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			for i := 0; r.Context().Err() == nil && i < 1024; i++ {
+				w.Write(content[:16])
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+		}},
+		{"late headers", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-1" {
+					mu.Lock()
+					requests++
+					first := requests == 1
+					mu.Unlock()
+					if first {
+						test.first(w, r)
+						return
+					}
+				}
+				http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			dm := newTestManager(t)
+			dm.SetTimeouts(Timeouts{ResponseHeader: 300 * time.Millisecond, IdleRead: 300 * time.Millisecond,
+				StallSpeed: 4, StallTime: 300 * time.Millisecond})
+			queue := &Queue{
+				ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 4, MaxRetries: 1,
+				RetryPolicy: &RetryPolicy{BaseDelay: time.Millisecond, Factor: 1, MaxDelay: time.Millisecond},
+			}
+			dm.AddQueue(queue)
+			defer dm.RemoveQueue(queue)
+			download := &Download{ID: 1, QueueID: 1, Queue: queue, Status: "pending", OutputFile: "file.bin", URL: server.URL}
+			dm.AddDownload(download)
+			waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+
+			snapshot := dm.Snapshot(download)
+			if snapshot.Status != "finished" || snapshot.FinalSize != int64(len(content)) {
+				t.Fatalf("the download is %s with %d bytes: %s", snapshot.Status, snapshot.FinalSize, snapshot.LastError)
+			}
+			if retries := snapshot.GetRetries(); retries != 1 {
+				t.Errorf("retried %d times, want once", retries)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultIdleConnsPerHost is how many idle connections to a single host are
+// kept for reuse until SetIdleConnections is called.
+const DefaultIdleConnsPerHost = 16
+
+// newTransport returns the transport all requests of a manager share. It
+// keeps idle connections for reuse, so the probes and parts of a download and
+// batches of small files from one server skip most connection and TLS
+// handshakes, and it speaks HTTP/2 to the servers that support it, which
+// carry the parts over one connection.
+func newTransport(timeouts Timeouts, idlePerHost int) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone() // with the proxy of the environment
+	transport.DialContext = (&net.Dialer{Timeout: timeouts.Connect, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeouts.TLSHandshake
+	transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	transport.ForceAttemptHTTP2 = true // a custom dialer turns it off otherwise
+	transport.MaxIdleConnsPerHost = idlePerHost
+	transport.MaxIdleConns = max(transport.MaxIdleConns, 4*idlePerHost)
+	return transport
+}
+
+// SetIdleConnections sets how many idle connections to a single host are
+// kept for reuse, 0 for the default.
+func (dm *DownloadManager) SetIdleConnections(perHost int) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.IdleConnsPerHost = perHost
+	if perHost <= 0 {
+		dm.IdleConnsPerHost = DefaultIdleConnsPerHost
+	}
+	dm.rebuildTransport()
+}
+
+// rebuildTransport replaces the transport after its settings changed. The
+// requests running keep the old one, whose idle connections are closed.
+// Callers hold dm.mu.
+func (dm *DownloadManager) rebuildTransport() {
+	if dm.transport != nil {
+		dm.transport.CloseIdleConnections()
+	}
+	dm.transport = newTransport(dm.Timeouts, dm.IdleConnsPerHost)
+}
+
+// client returns a client on the shared transport. Callers hold dm.mu.
+func (dm *DownloadManager) client() *http.Client {
+	return &http.Client{Transport: dm.transport}
+}
+
+// discardBody reads the rest of a short body and closes it, so that its
+// connection goes back to the pool instead of being closed.
+func discardBody(resp *http.Response) {
+	io.CopyN(io.Discard, resp.Body, 64*1024)
+	resp.Body.Close()
+}
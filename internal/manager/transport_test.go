@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransportReusesConnections(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4*1024)
+	modTime := time.Now()
+	for _, test := range []struct {
+		name  string
+		http2 bool
+	}{{"http/1.1", false}, {"http/2", true}} {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			connections, requests, otherProtocols := 0, 0, 0
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests++
+				if test.http2 && r.ProtoMajor != 2 {
+					otherProtocols++
+				}
+				mu.Unlock()
+				http.ServeContent(w, r, "file.bin", modTime, bytes.NewReader(content))
+			}))
+			server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					mu.Lock()
+					connections++
+					mu.Unlock()
+				}
+			}
+			dm := newTestManager(t)
+			if test.http2 {
+				server.EnableHTTP2 = true
+				server.StartTLS()
+				dm.transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+			} else {
+				server.Start()
+			}
+			defer server.Close()
+
+			queue := &Queue{ID: 1, SaveDir: t.TempDir(), MaxConcurrentDownloads: 1, MaxRetries: 1}
+			dm.AddQueue(queue)
+			defer dm.RemoveQueue(queue)
+			for i := 1; i <= 8; i++ { // one after another, the probes of downloads added together race for connections
+				download := &Download{ID: i, QueueID: 1, Queue: queue, Status: "pending",
+					OutputFile: fmt.Sprintf("file%d.bin", i), URL: server.URL}
+				dm.AddDownload(download)
+				waitForStatus(t, dm, download, 5*time.Second, "finished", "failed")
+				if snapshot := dm.Snapshot(download); snapshot.Status != "finished" {
+					t.Fatalf("download %d is %s: %s", i, snapshot.Status, snapshot.LastError)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if connections > 2 {
+				t.Errorf("%d requests opened %d connections, want them to share one or two", requests, connections)
+			}
+			if otherProtocols > 0 {
+				t.Errorf("%d of %d requests did not use HTTP/2", otherProtocols, requests)
+			}
+		})
+	}
+}
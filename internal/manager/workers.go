@@ -0,0 +1,74 @@
+package manager
+
+import "sync"
+
+// workerPool runs the parts of a queue's downloads, at most size of them at
+// once. A part that finds every worker busy waits in line and is taken over
+// by the next worker that finishes, so nothing waits in a loop for a slot.
+type workerPool struct {
+	mu      sync.Mutex
+	size    int
+	busy    int
+	waiting []func()
+	idle    func() // called when a worker leaves the pool, to schedule more parts
+}
+
+func newWorkerPool(size int, idle func()) *workerPool {
+	return &workerPool{size: size, idle: idle}
+}
+
+// free returns how many workers are not busy.
+func (p *workerPool) free() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return max(0, p.size-p.busy-len(p.waiting))
+}
+
+// capacity returns the number of workers.
+func (p *workerPool) capacity() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// setSize changes the number of workers. Running parts finish on their
+// worker, extra workers take over the parts in line right away.
+func (p *workerPool) setSize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	for p.busy < p.size && len(p.waiting) > 0 {
+		job := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		p.busy++
+		go p.work(job)
+	}
+}
+
+// submit runs the job on a free worker, or after the jobs in line when all are busy.
+func (p *workerPool) submit(job func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.busy < p.size {
+		p.busy++
+		go p.work(job)
+		return
+	}
+	p.waiting = append(p.waiting, job)
+}
+
+func (p *workerPool) work(job func()) {
+	for job != nil {
+		job()
+		p.mu.Lock()
+		job = nil
+		if len(p.waiting) > 0 && p.busy <= p.size {
+			job = p.waiting[0]
+			p.waiting = p.waiting[1:]
+		} else {
+			p.busy--
+		}
+		p.mu.Unlock()
+	}
+	p.idle()
+}
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/sajjad-mobe/gdm/internal/manager"
 )
 
 func (m *Model) showCreateQueueError() {
@@ -13,8 +15,7 @@ func (m *Model) showCreateQueueError() {
 
 	m.resetFieldsForTab1()
 	m.focusedField = 0
-	m.inputURL.Focus()
-	m.outputFileName.Blur()
+	m.updateFieldFocus()
 }
 
 func (m *Model) showURLValidationError() {
@@ -24,8 +25,52 @@ func (m *Model) showURLValidationError() {
 
 	m.resetFieldsForTab1()
 	m.focusedField = 0
-	m.inputURL.Focus()
-	m.outputFileName.Blur()
+	m.updateFieldFocus()
+}
+
+func (m *Model) handleStartAtError() {
+	m.errorMessage = "Invalid Start At Input! Use YYYY-MM-DD HH:MM."
+	m.confirmationMessage = ""
+	m.errorTime = time.Now()
+
+	m.focusedField = 3
+	m.updateFieldFocus()
+}
+
+func (m *Model) handleStopAtError() {
+	m.errorMessage = "Invalid Stop At Input! Use YYYY-MM-DD HH:MM, later than now and the start time."
+	m.confirmationMessage = ""
+	m.errorTime = time.Now()
+
+	m.focusedField = 4
+	m.updateFieldFocus()
+}
+
+func (m *Model) handleRepeatError(message string) {
+	m.errorMessage = message
+	m.confirmationMessage = ""
+	m.errorTime = time.Now()
+
+	m.focusedField = 5
+	m.updateFieldFocus()
+}
+
+func (m *Model) handleOnConflictError() {
+	m.errorMessage = "Invalid Conflict Policy Input! Use rename, overwrite, skip, resume or ask."
+	m.confirmationMessage = ""
+	m.errorTime = time.Now()
+
+	m.focusedField = 7
+	m.updateFieldFocus()
+}
+
+func (m *Model) handleKeepLastError() {
+	m.errorMessage = "Invalid Keep Last Input! Use a number, 0 keeps all versions."
+	m.confirmationMessage = ""
+	m.errorTime = time.Now()
+
+	m.focusedField = 6
+	m.updateFieldFocus()
 }
 
 func (m *Model) handleBWError() {
@@ -52,6 +97,36 @@ func (m *Model) handleRetriesError() {
 	m.setupsAfterErrorForQueues()
 }
 
+func (m *Model) handleConflictPolicyError() {
+	m.errorMessage = "Invalid Conflict Policy Input!"
+	m.confirmationMessage = ""
+	m.setupsAfterErrorForQueues()
+}
+
+func (m *Model) handleMinFreeSpaceError() {
+	m.errorMessage = "Invalid Min Free Space Input!"
+	m.confirmationMessage = ""
+	m.setupsAfterErrorForQueues()
+}
+
+func (m *Model) handleBWScheduleError(err error) {
+	m.errorMessage = "Invalid Bandwidth Schedule Input: " + err.Error()
+	m.confirmationMessage = ""
+	m.setupsAfterErrorForQueues()
+}
+
+func (m *Model) handleRetryPolicyError(err error) {
+	m.errorMessage = "Invalid Retry Backoff Input: " + err.Error()
+	m.confirmationMessage = ""
+	m.setupsAfterErrorForQueues()
+}
+
+func (m *Model) handleWeeklyScheduleError(err error) {
+	m.errorMessage = "Invalid Weekly Schedule Input: " + err.Error()
+	m.confirmationMessage = ""
+	m.setupsAfterErrorForQueues()
+}
+
 func (m *Model) handleAllErrors() {
 	// Logic for when all errors are present
 	m.errorMessage = "Max Concurrent, Max Bandwidth, Max Retries ,and Time inputs are invalid!"
@@ -128,11 +203,7 @@ func (m *Model) setupsAfterErrorForQueues() {
 	m.errorTime = time.Now()
 	m.resetFieldsForTab3()
 	m.focusedFieldForQueues = 0
-	m.saveDirInput.Focus()
-	m.maxConcurrentInput.Blur()
-	m.maxConcurrentInput.Blur()
-	m.activeStartTimeInput.Blur()
-	m.activeEndTimeInput.Blur()
+	m.updateFocusedFieldForTab3()
 }
 
 func (m *Model) showDownloadConfirmation() {
@@ -141,8 +212,16 @@ func (m *Model) showDownloadConfirmation() {
 
 	m.resetFieldsForTab1()
 	m.focusedField = 0
-	m.inputURL.Focus()
-	m.outputFileName.Blur()
+	m.updateFieldFocus()
+}
+
+func (m *Model) showRecurringConfirmation() {
+	m.confirmationMessage = "Recurring download has been added!"
+	m.confirmationTime = time.Now()
+
+	m.resetFieldsForTab1()
+	m.focusedField = 0
+	m.updateFieldFocus()
 }
 
 func (m *Model) showAddQConfirmation() {
@@ -151,11 +230,7 @@ func (m *Model) showAddQConfirmation() {
 
 	m.resetFieldsForTab3()
 	m.focusedFieldForQueues = 0
-	m.saveDirInput.Focus()
-	m.maxConcurrentInput.Blur()
-	m.maxConcurrentInput.Blur()
-	m.activeStartTimeInput.Blur()
-	m.activeEndTimeInput.Blur()
+	m.updateFocusedFieldForTab3()
 }
 
 func (m *Model) showEditQConfirmation() {
@@ -164,11 +239,7 @@ func (m *Model) showEditQConfirmation() {
 
 	m.resetFieldsForTab3()
 	m.focusedFieldForQueues = 0
-	m.saveDirInput.Focus()
-	m.maxConcurrentInput.Blur()
-	m.maxConcurrentInput.Blur()
-	m.activeStartTimeInput.Blur()
-	m.activeEndTimeInput.Blur()
+	m.updateFocusedFieldForTab3()
 }
 
 func (m *Model) CheckErrorCodes() int {
@@ -177,6 +248,28 @@ func (m *Model) CheckErrorCodes() int {
 	if !m.validateDirectory() {
 		return 1
 	}
+	if !regForConflictPolicy.MatchString(m.conflictPolicyInput.Value()) {
+		m.handleConflictPolicyError()
+		return 1
+	}
+	if !regForMinFreeSpace.MatchString(m.minFreeSpaceInput.Value()) {
+		m.handleMinFreeSpaceError()
+		return 1
+	}
+	if _, err := manager.ParseBandwidthSchedule(m.bwScheduleInput.Value()); err != nil {
+		m.handleBWScheduleError(err)
+		return 1
+	}
+	if _, err := manager.ParseRetryPolicy(m.retryPolicyInput.Value()); err != nil {
+		m.handleRetryPolicyError(err)
+		return 1
+	}
+	if _, err := manager.ParseWeeklySchedule(
+		m.weeklyScheduleInput.Value(), m.timeZoneInput.Value(), m.exceptionDatesInput.Value(),
+	); err != nil {
+		m.handleWeeklyScheduleError(err)
+		return 1
+	}
 
 	if !regForConcurrent.MatchString(m.maxConcurrentInput.Value()) {
 		concurrentError = true
@@ -1,10 +1,14 @@
 package tui
 
 import (
+	"context"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/sajjad-mobe/gdm/internal/manager"
 )
@@ -36,17 +40,33 @@ func (m *Model) handleNewDownloadSubmit() {
 		downloadURL := m.inputURL.Value()
 		// validate download url
 
-		outputFile := m.outputFileName.Value()
+		outputFile := strings.TrimSpace(m.outputFileName.Value())
 		// should be validated
 		queue := m.dataStore.Queues[m.queuesTable.Rows()[m.selectedQueueRowIndex][0]]
+		if strings.TrimSpace(m.repeatInput.Value()) != "" {
+			m.handleNewRecurringSubmit(queue)
+			return
+		}
+		startAt, stopAt, ok := m.parseDownloadSchedule()
+		if !ok {
+			return
+		}
+		conflictPolicy := strings.TrimSpace(m.onConflictInput.Value())
+		if !regForConflictPolicy.MatchString(conflictPolicy) {
+			m.handleOnConflictError()
+			return
+		}
 		m.maxDownloadID++
 		newDwnload := manager.Download{
-			ID:         m.maxDownloadID,
-			URL:        downloadURL,
-			QueueID:    queue.ID,
-			Queue:      queue,
-			OutputFile: outputFile,
-			Status:     "pending",
+			ID:             m.maxDownloadID,
+			URL:            downloadURL,
+			QueueID:        queue.ID,
+			Queue:          queue,
+			OutputFile:     outputFile,
+			StartAt:        startAt,
+			StopAt:         stopAt,
+			ConflictPolicy: conflictPolicy,
+			Status:         "pending",
 		}
 
 		m.addNewDownload(&newDwnload)
@@ -54,6 +74,9 @@ func (m *Model) handleNewDownloadSubmit() {
 		// Reset the form after submission
 		m.inputURL.Reset()
 		m.outputFileName.Reset()
+		m.startAtInput.Reset()
+		m.stopAtInput.Reset()
+		m.onConflictInput.Reset()
 
 		m.showDownloadConfirmation()
 	}
@@ -64,15 +87,7 @@ func (m *Model) addNewDownload(download *manager.Download) {
 	m.dataStore.AddDownload(download)
 	m.downloadmanager.AddDownload(download)
 
-	newRow := table.Row{
-		strconv.Itoa(download.ID),
-		strconv.Itoa(download.QueueID),
-		download.URL,
-		download.Status,
-		"N/A",
-		"N/A",
-		"0",
-	}
+	newRow := downloadToRow(m.downloadmanager, download, m.downloadmanager.Positions())
 
 	// Add the row to the downloadsTable
 	m.downloadsTable = table.New(
@@ -81,19 +96,40 @@ func (m *Model) addNewDownload(download *manager.Download) {
 	)
 }
 
+// parseDownloadSchedule reads the optional start and stop times in local time
+func (m *Model) parseDownloadSchedule() (startAt, stopAt time.Time, ok bool) {
+	var err error
+	if value := strings.TrimSpace(m.startAtInput.Value()); value != "" {
+		if startAt, err = time.ParseInLocation(dateTimeLayout, value, time.Local); err != nil {
+			m.handleStartAtError()
+			return startAt, stopAt, false
+		}
+	}
+	if value := strings.TrimSpace(m.stopAtInput.Value()); value != "" {
+		stopAt, err = time.ParseInLocation(dateTimeLayout, value, time.Local)
+		if err != nil || !stopAt.After(startAt) || !stopAt.After(time.Now()) {
+			m.handleStopAtError()
+			return startAt, stopAt, false
+		}
+	}
+	return startAt, stopAt, true
+}
+
 func (m *Model) resetFieldsForTab1() {
 	m.inputURL.SetValue("")
 	m.outputFileName.SetValue("")
+	m.startAtInput.SetValue("")
+	m.stopAtInput.SetValue("")
+	m.repeatInput.SetValue("")
+	m.keepLastInput.SetValue("")
+	m.onConflictInput.SetValue("")
 	m.selectedQueueRowIndex = 0
 }
 
 func (m *Model) resetFieldsForTab3() {
-	m.saveDirInput.SetValue("")
-	m.maxBandwidthInput.SetValue("")
-	m.maxRetriesPerDLInput.SetValue("")
-	m.maxConcurrentInput.SetValue("")
-	m.activeStartTimeInput.SetValue("")
-	m.activeEndTimeInput.SetValue("")
+	for _, input := range m.queueFormInputs() {
+		input.SetValue("")
+	}
 }
 
 func (m *Model) handleUpArrowForTab1() {
@@ -122,52 +158,63 @@ func (m *Model) handleDownArrowForTab2() {
 
 func (m *Model) updateFocusedFieldForTab1() {
 	if m.currentTab == tabAddDownload {
-		url := m.inputURL.Value()
-		if m.focusedField == 0 && len(m.outputFileName.Value()) == 0 {
-			if outputFileName, err := manager.GetFileNameFromURL(url); err == nil {
-				m.outputFileName.SetValue(outputFileName)
-			}
-		}
-		m.focusedField = (m.focusedField + 1) % 3
+		m.focusedField = (m.focusedField + 1) % 8
 		m.updateFieldFocus()
 	}
 }
 
 func (m *Model) updateFieldFocus() {
-	if m.focusedField == 0 {
-		m.inputURL.Focus()
-		m.outputFileName.Blur()
-	} else if m.focusedField == 1 {
-		m.inputURL.Blur()
-		m.outputFileName.Blur()
-	} else if m.focusedField == 2 {
-		m.outputFileName.Focus()
-		m.inputURL.Blur()
+	// the queue selection at index 1 has no text input
+	inputs := []*textinput.Model{&m.inputURL, nil, &m.outputFileName, &m.startAtInput, &m.stopAtInput, &m.repeatInput, &m.keepLastInput, &m.onConflictInput}
+	for i, input := range inputs {
+		if input == nil {
+			continue
+		}
+		if i == m.focusedField {
+			input.Focus()
+		} else {
+			input.Blur()
+		}
+	}
+}
+
+// queueFormInputs returns the queue form fields in their tab order
+func (m *Model) queueFormInputs() []*textinput.Model {
+	return []*textinput.Model{
+		&m.saveDirInput,
+		&m.maxConcurrentInput,
+		&m.maxBandwidthInput,
+		&m.maxRetriesPerDLInput,
+		&m.retryPolicyInput,
+		&m.activeStartTimeInput,
+		&m.activeEndTimeInput,
+		&m.conflictPolicyInput,
+		&m.minFreeSpaceInput,
+		&m.bwScheduleInput,
+		&m.weeklyScheduleInput,
+		&m.timeZoneInput,
+		&m.exceptionDatesInput,
 	}
 }
 
 // Update focus for the queue form fields
 func (m *Model) updateFocusedFieldForTab3() {
-	m.saveDirInput.Blur()
-	m.maxConcurrentInput.Blur()
-	m.maxBandwidthInput.Blur()
-	m.maxRetriesPerDLInput.Blur()
-	m.activeStartTimeInput.Blur()
-	m.activeEndTimeInput.Blur()
-	switch m.focusedFieldForQueues {
-	case 0:
-		m.saveDirInput.Focus()
-	case 1:
-		m.maxConcurrentInput.Focus()
-	case 2:
-		m.maxBandwidthInput.Focus()
-	case 3:
-		m.maxRetriesPerDLInput.Focus()
-	case 4:
-		m.activeStartTimeInput.Focus()
-	case 5:
-		m.activeEndTimeInput.Focus()
+	for i, input := range m.queueFormInputs() {
+		if i == m.focusedFieldForQueues {
+			input.Focus()
+		} else {
+			input.Blur()
+		}
+	}
+}
+
+// Reset the queue form fields and focus the first one
+func (m *Model) resetQueueForm() {
+	for _, input := range m.queueFormInputs() {
+		input.Reset()
 	}
+	m.focusedFieldForQueues = 0
+	m.updateFocusedFieldForTab3()
 }
 
 func (m *Model) clearMessages() {
@@ -180,6 +227,14 @@ func (m *Model) clearMessages() {
 	}
 }
 
+// Stop the transfers, keep their progress and quit
+func (m *Model) quit() tea.Cmd {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	m.downloadmanager.Shutdown(ctx) // saves the data store
+	return tea.Quit
+}
+
 // Add a method to handle Pause/Resume action
 func (m *Model) togglePauseDownload() {
 	if m.selectedRow >= 0 && m.selectedRow < len(m.downloadsTable.Rows()) {
@@ -235,6 +290,12 @@ func (m *Model) removeQueue() {
 		for _, download := range queue.Downloads {
 			m.dataStore.RemoveDownload(download)
 		}
+		for _, recurring := range m.dataStore.Recurrings {
+			if recurring.QueueID == queue.ID {
+				m.downloadmanager.RemoveRecurring(recurring)
+				m.dataStore.RemoveRecurring(recurring)
+			}
+		}
 		m.dataStore.RemoveQueue(queue)
 
 		// Update the queuesTable with the new rows
@@ -262,11 +323,84 @@ func (m *Model) retryDownload() {
 			// Retry the download
 			m.downloadsTable.Rows()[m.selectedRow][3] = "retrying" // Update status to "Retrying"
 			download := m.dataStore.Downloads[m.downloadsTable.Rows()[m.selectedRow][0]]
-			m.downloadmanager.RetryDownload(download)
+			// the parts that failed run again alone, the rest of the file is kept
+			var failed []int
+			for _, part := range m.downloadmanager.Snapshot(download).PartDownloaders {
+				if part.IsFailed {
+					failed = append(failed, part.Index)
+				}
+			}
+			if len(failed) == 0 || m.downloadmanager.RetryParts(download, failed...) != nil {
+				m.downloadmanager.RetryDownload(download)
+			}
 		}
 	}
 }
 
+// Set or clear the manual state of the selected queue
+func (m *Model) setQueueState(state string) {
+	queue := m.selectedQueue()
+	if queue == nil {
+		return
+	}
+	switch state {
+	case manager.QueuePaused:
+		m.downloadmanager.PauseQueue(queue)
+	case manager.QueueRunning:
+		m.downloadmanager.ResumeQueue(queue)
+	case manager.QueueDraining:
+		m.downloadmanager.DrainQueue(queue)
+	default:
+		m.downloadmanager.ClearQueueState(queue)
+	}
+	m.dataStore.Save()
+	m.updateQueueTable()
+}
+
+// Pause all queues, or resume those it paused when all are paused
+func (m *Model) togglePauseAll() {
+	if m.downloadmanager.IsAllPaused() {
+		m.downloadmanager.ResumeAll()
+		m.confirmationMessage = "The queues paused together have been resumed!"
+	} else {
+		m.downloadmanager.PauseAll()
+		m.confirmationMessage = "All queues have been paused!"
+	}
+	m.confirmationTime = time.Now()
+	m.dataStore.Save()
+	m.updateQueueTable()
+}
+
+// Move the selected download within its queue, priority first
+func (m *Model) moveDownload(key string) {
+	directions := map[string]string{
+		"[": manager.MoveUp,
+		"]": manager.MoveDown,
+		"{": manager.MoveTop,
+		"}": manager.MoveBottom,
+	}
+	if download := m.selectedDownload(); download != nil && download.Queue != nil {
+		m.downloadmanager.MoveDownload(download, directions[key])
+		m.updateDownloadTable()
+	}
+}
+
+// Switch the selected download to the next priority: high, normal, low
+func (m *Model) cyclePriority() {
+	if download := m.selectedDownload(); download != nil {
+		index := slices.Index(manager.Priorities, download.GetPriority())
+		m.downloadmanager.SetPriority(download, manager.Priorities[(index+1)%len(manager.Priorities)])
+		m.updateDownloadTable()
+	}
+}
+
+// Resolve a download waiting in the "conflict" status with the chosen policy
+func (m *Model) resolveConflict(policy string) {
+	if download := m.selectedDownload(); download != nil && m.downloadmanager.Status(download) == "conflict" {
+		m.downloadmanager.ResolveConflict(download, policy)
+	}
+}
+
 func (m *Model) updateFocusedField(msg tea.Msg) {
 	if m.focusedField == 0 {
 		m.inputURL.Update(msg)
@@ -311,22 +445,36 @@ func (m *Model) handleNewOrEditQueueFormSubmit() {
 		if m.activeEndTimeInput.Value() == "" {
 			m.activeEndTimeInput.SetValue("23:59")
 		}
+		if m.conflictPolicyInput.Value() == "" {
+			m.conflictPolicyInput.SetValue(manager.ConflictRename)
+		}
+		bwSchedule, _ := manager.ParseBandwidthSchedule(m.bwScheduleInput.Value()) // checked in CheckErrorCodes
+		retryPolicy, _ := manager.ParseRetryPolicy(m.retryPolicyInput.Value())
+		minFreeSpace, _ := strconv.Atoi(m.minFreeSpaceInput.Value()) // empty for no reserve
+		schedule, _ := manager.ParseWeeklySchedule(
+			m.weeklyScheduleInput.Value(), m.timeZoneInput.Value(), m.exceptionDatesInput.Value(),
+		)
 
 		if m.editQueueForm {
 			if m.selectedRow >= 0 && m.selectedRow < len(m.queuesTable.Rows()) {
 				oldQueueRow := m.queuesTable.Rows()[m.selectedRow]
 
 				thisQueue := m.dataStore.Queues[oldQueueRow[0]]
-				thisQueue.SaveDir = m.saveDirInput.Value()
-				thisQueue.MaxConcurrentDownloads = MaxConcurrentDownloads
-				thisQueue.MaxRetries = MaxRetries
-
-				thisQueue.ActiveStartTime = m.activeStartTimeInput.Value()
-				thisQueue.ActiveEndTime = m.activeEndTimeInput.Value()
-
-				if thisQueue.MaxBandwidth != MaxBandwidth {
-					thisQueue.SetBandwith(MaxBandwidth)
-				}
+				m.downloadmanager.UpdateQueue(thisQueue, func(queue *manager.Queue) {
+					queue.SaveDir = m.saveDirInput.Value()
+					queue.MaxConcurrentDownloads = MaxConcurrentDownloads
+					queue.MaxRetries = MaxRetries
+					queue.RetryPolicy = retryPolicy
+
+					queue.ActiveStartTime = m.activeStartTimeInput.Value()
+					queue.ActiveEndTime = m.activeEndTimeInput.Value()
+					queue.ConflictPolicy = m.conflictPolicyInput.Value()
+					queue.MinFreeSpace = minFreeSpace
+					queue.Schedule = schedule
+
+					queue.MaxBandwidth = MaxBandwidth
+					queue.SetBandwidthSchedule(bwSchedule)
+				})
 
 				m.editQueue(oldQueueRow, thisQueue)
 				m.newQueueForm = false
@@ -341,8 +489,13 @@ func (m *Model) handleNewOrEditQueueFormSubmit() {
 				MaxConcurrentDownloads: MaxConcurrentDownloads,
 				MaxBandwidth:           MaxBandwidth,
 				MaxRetries:             MaxRetries,
+				RetryPolicy:            retryPolicy,
 				ActiveStartTime:        m.activeStartTimeInput.Value(),
 				ActiveEndTime:          m.activeEndTimeInput.Value(),
+				ConflictPolicy:         m.conflictPolicyInput.Value(),
+				MinFreeSpace:           minFreeSpace,
+				BandwidthSchedule:      bwSchedule,
+				Schedule:               schedule,
 			}
 			// Adding a new queue
 			m.addNewQueue(&newQueue)
@@ -353,20 +506,7 @@ func (m *Model) handleNewOrEditQueueFormSubmit() {
 
 		// Reset the form after submission
 
-		m.saveDirInput.Reset()
-		m.maxConcurrentInput.Reset()
-		m.maxBandwidthInput.Reset()
-		m.maxRetriesPerDLInput.Reset()
-		m.activeStartTimeInput.Reset()
-		m.activeEndTimeInput.Reset()
-		m.saveDirInput.Focus()
-		m.maxConcurrentInput.Blur()
-		m.maxBandwidthInput.Blur()
-		m.maxRetriesPerDLInput.Blur()
-		m.activeStartTimeInput.Blur()
-		m.activeEndTimeInput.Blur()
-
-		m.focusedFieldForQueues = 0
+		m.resetQueueForm()
 		counterForForms = 0
 	}
 }
@@ -376,15 +516,7 @@ func (m *Model) addNewQueue(queue *manager.Queue) {
 	m.dataStore.AddQueue(queue)
 	m.downloadmanager.AddQueue(queue)
 
-	newRow := table.Row{
-		strconv.Itoa(queue.ID),
-		queue.SaveDir,
-		strconv.Itoa(queue.MaxConcurrentDownloads),
-		strconv.Itoa(queue.MaxBandwidth),
-		strconv.Itoa(queue.MaxRetries),
-		queue.ActiveStartTime,
-		queue.ActiveEndTime,
-	}
+	newRow := queueToRow(queue, m.downloadmanager.Clock.Now())
 
 	// Add the row to the queuesTable
 	m.queuesTable = table.New(
@@ -397,15 +529,7 @@ func (m *Model) addNewQueue(queue *manager.Queue) {
 func (m *Model) editQueue(oldQueueRow table.Row, queue *manager.Queue) {
 	m.dataStore.Save()
 	// Update the selected queue with new values
-	m.queuesTable.Rows()[m.selectedRow] = table.Row{
-		oldQueueRow[0],
-		queue.SaveDir,
-		strconv.Itoa(queue.MaxConcurrentDownloads),
-		strconv.Itoa(queue.MaxBandwidth),
-		strconv.Itoa(queue.MaxRetries),
-		queue.ActiveStartTime,
-		queue.ActiveEndTime,
-	}
+	m.queuesTable.Rows()[m.selectedRow] = queueToRow(queue, m.downloadmanager.Clock.Now())
 
 	// Update the table
 	m.queuesTable = table.New(
@@ -419,26 +543,14 @@ func (m *Model) handleCancel() {
 	if m.newQueueForm {
 		// If adding a new queue, cancel and reset the form
 		m.newQueueForm = false
-		m.saveDirInput.Reset()
-		m.maxConcurrentInput.Reset()
-		m.maxBandwidthInput.Reset()
-		m.maxRetriesPerDLInput.Reset()
-		m.activeStartTimeInput.Reset()
-		m.activeEndTimeInput.Reset()
+		m.resetQueueForm()
 		counterForForms = 0
-		m.focusedFieldForQueues = 0
 	}
 	if m.editQueueForm {
 		// If editing a queue, cancel the edit and return to the queue list
 		m.editQueueForm = false
-		m.saveDirInput.Reset()
-		m.maxConcurrentInput.Reset()
-		m.maxBandwidthInput.Reset()
-		m.maxRetriesPerDLInput.Reset()
-		m.activeStartTimeInput.Reset()
-		m.activeEndTimeInput.Reset()
+		m.resetQueueForm()
 		counterForForms = 0
-		m.focusedFieldForQueues = 0
 	}
 	// Ensure we are in the "Queues" tab and re-render it
 	m.currentTab = tabQueues
@@ -480,6 +592,19 @@ func (m *Model) handleSwitchToEditQueueForm() {
 			m.maxConcurrentInput.SetValue(strconv.Itoa(thisQueue.MaxConcurrentDownloads))
 			m.maxBandwidthInput.SetValue(strconv.Itoa(thisQueue.MaxBandwidth))
 			m.maxRetriesPerDLInput.SetValue(strconv.Itoa(thisQueue.MaxRetries))
+			m.retryPolicyInput.SetValue(manager.FormatRetryPolicy(thisQueue.RetryPolicy))
+			m.activeStartTimeInput.SetValue(thisQueue.ActiveStartTime)
+			m.activeEndTimeInput.SetValue(thisQueue.ActiveEndTime)
+			m.conflictPolicyInput.SetValue(thisQueue.ConflictPolicy)
+			if thisQueue.MinFreeSpace > 0 {
+				m.minFreeSpaceInput.SetValue(strconv.Itoa(thisQueue.MinFreeSpace))
+			}
+			m.bwScheduleInput.SetValue(manager.FormatBandwidthSchedule(thisQueue.BandwidthSchedule))
+			if thisQueue.Schedule != nil {
+				m.weeklyScheduleInput.SetValue(manager.FormatScheduleWindows(thisQueue.Schedule))
+				m.timeZoneInput.SetValue(thisQueue.Schedule.TimeZone)
+				m.exceptionDatesInput.SetValue(strings.Join(thisQueue.Schedule.Exceptions, ", "))
+			}
 
 			// queue[0]
 			m.updateFocusedFieldForTab3()
@@ -496,6 +621,16 @@ func (m *Model) updateBasedOnInputForTab1(msg tea.Msg, _ tea.Cmd) {
 			// m.selectedQueueRowIndex = 0
 		} else if m.focusedField == 2 {
 			m.outputFileName, _ = m.outputFileName.Update(msg)
+		} else if m.focusedField == 3 {
+			m.startAtInput, _ = m.startAtInput.Update(msg)
+		} else if m.focusedField == 4 {
+			m.stopAtInput, _ = m.stopAtInput.Update(msg)
+		} else if m.focusedField == 5 {
+			m.repeatInput, _ = m.repeatInput.Update(msg)
+		} else if m.focusedField == 6 {
+			m.keepLastInput, _ = m.keepLastInput.Update(msg)
+		} else if m.focusedField == 7 {
+			m.onConflictInput, _ = m.onConflictInput.Update(msg)
 		}
 		// Update the focused field accordingly
 		m.updateFocusedField(msg)
@@ -505,19 +640,7 @@ func (m *Model) updateBasedOnInputForTab1(msg tea.Msg, _ tea.Cmd) {
 func (m *Model) updateBasedOnInputForTab3(msg tea.Msg, _ tea.Cmd) {
 	if m.newQueueForm || m.editQueueForm {
 		counterForForms = counterForForms + 1
-		switch m.focusedFieldForQueues {
-		case 0:
-			m.saveDirInput, _ = m.saveDirInput.Update(msg)
-		case 1:
-			m.maxConcurrentInput, _ = m.maxConcurrentInput.Update(msg)
-		case 2:
-			m.maxBandwidthInput, _ = m.maxBandwidthInput.Update(msg)
-		case 3:
-			m.maxRetriesPerDLInput, _ = m.maxRetriesPerDLInput.Update(msg)
-		case 4:
-			m.activeStartTimeInput, _ = m.activeStartTimeInput.Update(msg)
-		case 5:
-			m.activeEndTimeInput, _ = m.activeEndTimeInput.Update(msg)
-		}
+		input := m.queueFormInputs()[m.focusedFieldForQueues]
+		*input, _ = input.Update(msg)
 	}
 }
@@ -0,0 +1,221 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sajjad-mobe/gdm/internal/manager"
+)
+
+// Kinds of the one line prompt shown under the tables
+const (
+	promptNone = iota
+	promptGlobalBandwidth
+	promptDownloadBandwidth
+	promptMoveDownload
+	promptConnectionLimits
+	promptDependencies
+	promptQueueDependency
+	promptTimeouts
+)
+
+var promptTitles = map[int]string{
+	promptGlobalBandwidth:   "Global bandwidth limit in KB/s (0 for unlimited):",
+	promptDownloadBandwidth: "Bandwidth limit of the selected download in KB/s (0 for unlimited):",
+	promptMoveDownload:      "Move the selected download to the queue with ID:",
+	promptConnectionLimits:  "Connection limits of all queues together and per host, then idle ones kept per host, e.g. 16 4 16 (0 for unlimited, the default for idle ones):",
+	promptDependencies:      "Start the selected download after the downloads with IDs, e.g. 3 4 block (or cascade, ignore if one fails), empty for none:",
+	promptQueueDependency:   "Start the selected queue when the queue with ID is done (0 for none):",
+	promptTimeouts:          "Timeouts to connect, for TLS, headers and idle reads, then the stall speed in KB/s and time, e.g. 30s 15s 30s 1m 1 1m:",
+}
+
+func (m *Model) openPrompt(kind int, value string) {
+	m.promptKind = kind
+	m.promptInput.SetValue(value)
+	m.promptInput.CursorEnd()
+	m.promptInput.Focus()
+}
+
+func (m *Model) closePrompt() {
+	m.promptKind = promptNone
+	m.promptInput.Reset()
+	m.promptInput.Blur()
+}
+
+// Handle keys while a prompt is open, enter submits and esc cancels
+func (m *Model) handlePromptKey(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "esc":
+		m.closePrompt()
+	case "enter":
+		m.submitPrompt()
+	default:
+		m.promptInput, _ = m.promptInput.Update(msg)
+	}
+}
+
+func (m *Model) submitPrompt() {
+	value := m.promptInput.Value()
+	switch m.promptKind {
+	case promptGlobalBandwidth:
+		bandwidth, ok := parseBandwidth(value)
+		if !ok {
+			m.showPromptError("Invalid Bandwidth Input!")
+			return
+		}
+		m.downloadmanager.SetGlobalBandwidth(bandwidth)
+		m.dataStore.Settings.GlobalBandwidth = bandwidth
+		m.dataStore.Save()
+		m.showPromptConfirmation("Global bandwidth limit has been set!")
+	case promptDownloadBandwidth:
+		bandwidth, ok := parseBandwidth(value)
+		if !ok {
+			m.showPromptError("Invalid Bandwidth Input!")
+			return
+		}
+		download := m.selectedDownload()
+		if download != nil {
+			m.downloadmanager.SetDownloadBandwidth(download, bandwidth)
+			m.dataStore.Save()
+		}
+		m.showPromptConfirmation("Download bandwidth limit has been set!")
+	case promptMoveDownload:
+		queue := m.dataStore.Queues[strings.TrimSpace(value)]
+		download := m.selectedDownload()
+		if queue == nil || download == nil {
+			m.showPromptError("Invalid Queue ID Input!")
+			return
+		}
+		if err := m.downloadmanager.MoveDownloadToQueue(download, queue); err != nil {
+			m.showPromptError("Can not move the download: " + err.Error())
+			return
+		}
+		m.dataStore.Save()
+		m.updateDownloadTable()
+		m.showPromptConfirmation(fmt.Sprintf("Download has been moved to queue %d!", queue.ID))
+	case promptConnectionLimits:
+		total, perHost, idlePerHost, ok := parseConnectionLimits(value)
+		if !ok {
+			m.showPromptError("Invalid Connection Limits Input!")
+			return
+		}
+		m.downloadmanager.SetConnectionLimits(total, perHost)
+		m.downloadmanager.SetIdleConnections(idlePerHost)
+		m.dataStore.Settings.MaxConnections = total
+		m.dataStore.Settings.MaxConnectionsPerHost = perHost
+		m.dataStore.Settings.IdleConnsPerHost = idlePerHost
+		m.dataStore.Save()
+		m.showPromptConfirmation("Connection limits have been set!")
+	case promptDependencies:
+		ids, policy, ok := parseDependencies(value)
+		download := m.selectedDownload()
+		if !ok || download == nil {
+			m.showPromptError("Invalid Dependencies Input!")
+			return
+		}
+		if err := m.downloadmanager.SetDependencies(download, ids, policy); err != nil {
+			m.showPromptError("Can not set the dependencies: " + err.Error())
+			return
+		}
+		m.dataStore.Save()
+		m.updateDownloadTable()
+		m.showPromptConfirmation("Download dependencies have been set!")
+	case promptQueueDependency:
+		id, err := strconv.Atoi(strings.TrimSpace(value))
+		queue := m.selectedQueue()
+		if err != nil || queue == nil {
+			m.showPromptError("Invalid Queue ID Input!")
+			return
+		}
+		if err := m.downloadmanager.SetQueueDependency(queue, id); err != nil {
+			m.showPromptError("Can not set the queue dependency: " + err.Error())
+			return
+		}
+		m.dataStore.Save()
+		m.updateQueueTable()
+		m.showPromptConfirmation("Queue dependency has been set!")
+	case promptTimeouts:
+		timeouts, err := manager.ParseTimeouts(value)
+		if err != nil {
+			m.showPromptError("Invalid Timeouts Input: " + err.Error())
+			return
+		}
+		m.downloadmanager.SetTimeouts(timeouts)
+		m.dataStore.Settings.Timeouts = &timeouts
+		m.dataStore.Save()
+		m.showPromptConfirmation("Timeouts have been set!")
+	}
+	m.closePrompt()
+}
+
+func parseBandwidth(value string) (int, bool) {
+	if !regForMaxBW.MatchString(value) {
+		return 0, false
+	}
+	bandwidth, err := strconv.Atoi(value)
+	return bandwidth, err == nil && bandwidth >= 0
+}
+
+// parseConnectionLimits reads the total and per host limits and the idle connections kept per host,
+// the last two may be left out
+func parseConnectionLimits(value string) (total, perHost, idlePerHost int, ok bool) {
+	fields := strings.Fields(value)
+	if len(fields) < 1 || len(fields) > 3 {
+		return 0, 0, 0, false
+	}
+	limits := []int{0, 0, 0}
+	for i, field := range fields {
+		limit, err := strconv.Atoi(field)
+		if err != nil || limit < 0 {
+			return 0, 0, 0, false
+		}
+		limits[i] = limit
+	}
+	return limits[0], limits[1], limits[2], true
+}
+
+// parseDependencies reads download IDs optionally followed by a dependency policy
+func parseDependencies(value string) (ids []int, policy string, ok bool) {
+	fields := strings.Fields(value)
+	if len(fields) > 0 && slices.Contains(manager.DependencyPolicies, fields[len(fields)-1]) {
+		policy = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+	for _, field := range fields {
+		id, err := strconv.Atoi(strings.Trim(field, ","))
+		if err != nil || id <= 0 {
+			return nil, "", false
+		}
+		ids = append(ids, id)
+	}
+	return ids, policy, true
+}
+
+func (m *Model) showPromptError(message string) {
+	m.errorMessage = message
+	m.confirmationMessage = ""
+	m.errorTime = time.Now()
+}
+
+func (m *Model) showPromptConfirmation(message string) {
+	m.confirmationMessage = message
+	m.errorMessage = ""
+	m.confirmationTime = time.Now()
+}
+
+func (m *Model) renderPrompt() string {
+	if m.promptKind == promptNone {
+		return ""
+	}
+	return fmt.Sprintf(
+		"\n\n%s\n%s\n%s",
+		greenTitleStyle.Render(promptTitles[m.promptKind]),
+		cursorStyle.Render("> ")+m.promptInput.View(),
+		lipgloss.NewStyle().Italic(true).Foreground(lipgloss.Color("#F39C12")).Render("Press Enter to submit, or Esc to cancel."),
+	)
+}
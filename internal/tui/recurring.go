@@ -0,0 +1,259 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sajjad-mobe/gdm/internal/manager"
+)
+
+// Define the table columns for the Recurring tab
+var recurringColumns = []table.Column{
+	{Title: "ID", Width: 4},
+	{Title: "Queue ID", Width: 8},
+	{Title: "URL", Width: 36},
+	{Title: "Repeat", Width: 14},
+	{Title: "Name Template", Width: 20},
+	{Title: "Keep", Width: 5},
+	{Title: "Next Run", Width: 16},
+	{Title: "Last Run", Width: 24},
+}
+
+// Handle the submission of the Add Download form when Repeat is filled
+func (m *Model) handleNewRecurringSubmit(queue *manager.Queue) {
+	if m.startAtInput.Value() != "" || m.stopAtInput.Value() != "" {
+		m.handleRepeatError("Start At and Stop At do not apply to repeated downloads!")
+		return
+	}
+	keepLast := 0
+	if value := strings.TrimSpace(m.keepLastInput.Value()); value != "" {
+		var err error
+		if keepLast, err = strconv.Atoi(value); err != nil || keepLast < 0 {
+			m.handleKeepLastError()
+			return
+		}
+	}
+
+	recurring := &manager.Recurring{
+		ID:           m.maxRecurringID + 1,
+		QueueID:      queue.ID,
+		Queue:        queue,
+		URL:          m.inputURL.Value(),
+		Cron:         strings.TrimSpace(m.repeatInput.Value()),
+		NameTemplate: m.outputFileName.Value(),
+		KeepLast:     keepLast,
+	}
+	if err := m.downloadmanager.AddRecurring(recurring); err != nil {
+		m.handleRepeatError("Invalid Repeat Input! Use a cron expression such as 0 2 * * * or @daily.")
+		return
+	}
+	m.maxRecurringID++
+	m.dataStore.AddRecurring(recurring)
+	m.showRecurringConfirmation()
+}
+
+// recurringRows returns the recurring downloads, newest first
+func (m *Model) recurringRows() []*manager.Recurring {
+	recurrings := make([]*manager.Recurring, 0, len(m.dataStore.Recurrings))
+	for _, recurring := range m.dataStore.Recurrings {
+		recurrings = append(recurrings, recurring)
+	}
+	sort.Slice(recurrings, func(i, j int) bool { return recurrings[i].ID > recurrings[j].ID })
+	return recurrings
+}
+
+func (m *Model) selectedRecurring() *manager.Recurring {
+	recurrings := m.recurringRows()
+	if m.selectedRow < 0 || m.selectedRow >= len(recurrings) {
+		return nil
+	}
+	return recurrings[m.selectedRow]
+}
+
+func (m *Model) handleDownArrowForRecurring() {
+	if m.selectedRow < len(m.dataStore.Recurrings)-1 {
+		m.selectedRow++
+	}
+}
+
+func (m *Model) removeRecurring() {
+	if recurring := m.selectedRecurring(); recurring != nil {
+		m.downloadmanager.RemoveRecurring(recurring)
+		m.dataStore.RemoveRecurring(recurring)
+		if m.selectedRow >= len(m.dataStore.Recurrings) {
+			m.selectedRow = len(m.dataStore.Recurrings) - 1
+		}
+	}
+}
+
+func (m *Model) runRecurringNow() {
+	if recurring := m.selectedRecurring(); recurring != nil {
+		m.downloadmanager.RunRecurringNow(recurring)
+	}
+}
+
+// addRecurringDownloads gives the downloads started by recurring definitions an ID and lists them
+func (m *Model) addRecurringDownloads() {
+	for {
+		select {
+		case download := <-m.downloadmanager.RecurringDownloads:
+			m.maxDownloadID++
+			download.ID = m.maxDownloadID
+			m.addNewDownload(download)
+		default:
+			return
+		}
+	}
+}
+
+// saveRecurringRuns persists the history as soon as a recurring run finishes
+func (m *Model) saveRecurringRuns() {
+	changed := false
+	for _, recurring := range m.dataStore.Recurrings {
+		if run := m.downloadmanager.RecurringSnapshot(recurring).LastRun(); run != nil && run.FinishedAt.After(m.recurringSavedAt) {
+			m.recurringSavedAt = run.FinishedAt
+			changed = true
+		}
+	}
+	if changed {
+		m.dataStore.Save()
+	}
+}
+
+func recurringToRow(recurring *manager.Recurring) table.Row {
+	template := recurring.NameTemplate
+	if template == "" {
+		template = manager.DefaultNameTemplate
+	}
+	keep := "All"
+	if recurring.KeepLast > 0 {
+		keep = strconv.Itoa(recurring.KeepLast)
+	}
+	nextRun := "-"
+	if !recurring.NextRun.IsZero() && !recurring.IsRemoved {
+		nextRun = recurring.NextRun.Local().Format(dateTimeLayout)
+	}
+	lastRun := "-"
+	if run := recurring.LastRun(); run != nil {
+		lastRun = run.Result + " " + run.StartedAt.Local().Format("01-02 15:04")
+	}
+	return table.Row{
+		strconv.Itoa(recurring.ID),
+		strconv.Itoa(recurring.QueueID),
+		recurring.URL,
+		recurring.Cron,
+		template,
+		keep,
+		nextRun,
+		lastRun,
+	}
+}
+
+func (m *Model) renderRecurringTab(tabsRow string) string {
+	columns := recurringColumns
+
+	// Define a table style with rounded borders, padding, and margin.
+	tableStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("5")).
+		Padding(1).
+		Margin(1)
+
+	// Build the header row with colorful cells.
+	headerRow := ""
+	for i, column := range columns {
+		// Alternate between lemon yellow (odd) and sky blue (even)
+		bgColor := "#87CEEB" // Sky blue for even columns
+		if i%2 == 0 {
+			bgColor = "#FFFF9F" // Lemon yellow for odd columns
+		}
+
+		headerCellStyle := lipgloss.NewStyle().
+			Bold(true).
+			Background(lipgloss.Color(bgColor)).
+			Foreground(lipgloss.Color("0")).
+			Padding(0, 1)
+		headerRow += headerCellStyle.Render(fmt.Sprintf("%-*s", column.Width, column.Title))
+	}
+
+	// Build table rows with colorful cells.
+	tableRows := []string{headerRow}
+	for rowIndex, recurring := range m.recurringRows() {
+		rowStr := ""
+		for colIndex, cell := range recurringToRow(m.downloadmanager.RecurringSnapshot(recurring)) {
+			if width := columns[colIndex].Width; len(cell) > width {
+				cell = cell[:width-3] + "..."
+			}
+			// Alternate between lemon yellow (odd) and sky blue (even)
+			bgColor := "#87CEEB" // Sky blue for even columns
+			if colIndex%2 == 0 {
+				bgColor = "#FFFF9F" // Lemon yellow for odd columns
+			}
+
+			cellStyle := lipgloss.NewStyle().
+				Background(lipgloss.Color(bgColor)).
+				Foreground(lipgloss.Color("0")).
+				Padding(0, 1)
+
+			// If the row is selected, override with a distinct style.
+			if rowIndex == m.selectedRow {
+				cellStyle = cellStyle.Copy().
+					Background(lipgloss.Color("4")).
+					Foreground(lipgloss.Color("0"))
+			}
+
+			rowStr += cellStyle.Render(fmt.Sprintf("%-*s", columns[colIndex].Width, cell))
+		}
+		tableRows = append(tableRows, rowStr)
+	}
+
+	tableContent := lipgloss.JoinVertical(lipgloss.Left, tableRows...)
+	content := fmt.Sprintf("%s\n\n%s", tabsRow, tableStyle.Render(tableContent))
+	if m.showDetails {
+		content += fmt.Sprintf("\n\n%s", m.renderRecurringHistory())
+	}
+
+	navigationStyle := lipgloss.NewStyle().
+		Italic(true).
+		Foreground(lipgloss.Color("#F39C12"))
+	content += fmt.Sprintf("\n\n%s", navigationStyle.Render("    Use shift+right/left to navigate through the tabs."))
+	return content
+}
+
+// renderRecurringHistory lists the latest runs of the selected recurring download
+func (m *Model) renderRecurringHistory() string {
+	recurring := m.selectedRecurring()
+	if recurring == nil {
+		return ""
+	}
+	recurring = m.downloadmanager.RecurringSnapshot(recurring)
+	const shownRuns = 8
+
+	content := greenTitleStyle.Render(fmt.Sprintf("Recurring download %d history:", recurring.ID))
+	if len(recurring.History) == 0 {
+		return content + "\n  No runs yet."
+	}
+	history := recurring.History
+	if len(history) > shownRuns {
+		history = history[len(history)-shownRuns:]
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		run := history[i]
+		line := fmt.Sprintf("%s  %-10s", run.StartedAt.Local().Format("2006-01-02 15:04:05"), run.Result)
+		if run.DownloadID != 0 {
+			line += fmt.Sprintf("  download %d", run.DownloadID)
+		}
+		if run.Path != "" {
+			line += "  " + run.Path
+		}
+		if run.Error != "" {
+			line += "  " + redErrorStyle.Render(run.Error)
+		}
+		content += "\n  " + line
+	}
+	return content
+}
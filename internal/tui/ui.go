@@ -2,9 +2,11 @@ package tui
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sajjad-mobe/gdm/internal/manager"
@@ -16,31 +18,42 @@ import (
 )
 
 // Global Variables
+const dateTimeLayout = "2006-01-02 15:04"
+
+// shutdownTimeout bounds how long quitting waits for the transfers to stop
+const shutdownTimeout = 5 * time.Second
+
 var counterForForms = 0
 var regForConcurrent = regexp.MustCompile(`^([1-9][0-9]{0,2}|200)$`)
 var regForMaxBW = regexp.MustCompile(`^[1-9]\d*$|0`)
 var regForHHMMFormat = regexp.MustCompile(`^(?:[01]?[0-9]|2[0-3]):([0-5]?[0-9])$|^$`)
+var regForConflictPolicy = regexp.MustCompile(`^(rename|overwrite|skip|resume|ask)?$`)
+var regForMinFreeSpace = regexp.MustCompile(`^\d*$`)
 
 // Define your table columns for the Downloads tab
 var downloadColumns = []table.Column{
-	{Title: "Download ID", Width: 13},
-	{Title: "Queue ID", Width: 10},
-	{Title: "URL", Width: 50},
+	{Title: "Download ID", Width: 11},
+	{Title: "Queue ID", Width: 8},
+	{Title: "URL", Width: 33},
 	{Title: "Status", Width: 10},
-	{Title: "Progress", Width: 10},
-	{Title: "Speed", Width: 10},
-	{Title: "Retries", Width: 10},
+	{Title: "Progress", Width: 9},
+	{Title: "Speed", Width: 9},
+	{Title: "Retries", Width: 7},
+	{Title: "Saved As", Width: 19},
+	{Title: "Priority", Width: 9},
+	{Title: "Error", Width: 16},
 }
 
 // Define your table columns for the Queues tab
 var queueColumns = []table.Column{
 	{Title: "Queue ID", Width: 10},
-	{Title: "SaveDir", Width: 50},
-	{Title: "Max Concurrent", Width: 16},
-	{Title: "Max Bandwidth", Width: 15},
-	{Title: "Max Retries", Width: 13},
-	{Title: "Active Start Time", Width: 19},
-	{Title: "Active End Time", Width: 19},
+	{Title: "SaveDir", Width: 30},
+	{Title: "Max Concurrent", Width: 14},
+	{Title: "Max Bandwidth", Width: 13},
+	{Title: "Max Retries", Width: 11},
+	{Title: "Active Hours", Width: 22},
+	{Title: "On Conflict", Width: 11},
+	{Title: "Current BW", Width: 14},
 }
 
 // Tabs constants
@@ -48,6 +61,7 @@ const (
 	tabAddDownload = iota
 	tabDownloads
 	tabQueues
+	tabRecurring
 	tabHelp // New help page tab
 )
 
@@ -62,13 +76,19 @@ type Model struct {
 	currentTab            int
 	inputURL              textinput.Model
 	outputFileName        textinput.Model
+	startAtInput          textinput.Model
+	stopAtInput           textinput.Model
+	repeatInput           textinput.Model
+	keepLastInput         textinput.Model
+	onConflictInput       textinput.Model
 	selectedQueueRowIndex int       // Tracks selected pages
-	focusedField          int       // 0 for inputURL, 1 for queueSelect, 2 for outputFileName
+	focusedField          int       // 0 for inputURL, 1 for queueSelect, 2 for outputFileName, 3 to 6 for the schedule, 7 for the conflict policy
 	confirmationMessage   string    // Holds the confirmation message
 	errorMessage          string    // Holds the error message (if URL is empty)
 	confirmationTime      time.Time // Time when confirmation message was set
 	errorTime             time.Time // Time when error message was set
 	downloadsTable        table.Model
+	showDetails           bool // Shows the details of the selected download
 	selectedRow           int
 	queuesTable           table.Model // Add the queuesTable field
 	// editingQueue          *manager.Queue // Holds the queue currently being edited (nil if no queue is being edited)
@@ -79,12 +99,23 @@ type Model struct {
 	maxConcurrentInput    textinput.Model
 	maxBandwidthInput     textinput.Model
 	maxRetriesPerDLInput  textinput.Model
+	retryPolicyInput      textinput.Model
 	activeStartTimeInput  textinput.Model
 	activeEndTimeInput    textinput.Model
+	conflictPolicyInput   textinput.Model
+	minFreeSpaceInput     textinput.Model // MB the queue leaves free on the disks
+	bwScheduleInput       textinput.Model
+	weeklyScheduleInput   textinput.Model
+	timeZoneInput         textinput.Model
+	exceptionDatesInput   textinput.Model
 	focusedFieldForQueues int
+	promptInput           textinput.Model // One line input for the prompts under the tables
+	promptKind            int
 	dataStore             *manager.DataStore
 	maxQueueID            int
 	maxDownloadID         int
+	maxRecurringID        int
+	recurringSavedAt      time.Time // FinishedAt of the latest recurring run saved to the store
 	downloadmanager       *manager.DownloadManager
 	width, height         int
 }
@@ -123,9 +154,14 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case updateDownloadMsg:
+		m.addRecurringDownloads()
+		m.saveRecurringRuns()
 		if m.currentTab == tabDownloads {
 			m.updateDownloadTable()
 		}
+		if m.currentTab == tabQueues && !m.newQueueForm && !m.editQueueForm {
+			m.updateQueueTable()
+		}
 		return m, tickToUpdateDownloadTable()
 	case tea.KeyMsg:
 		if m.width < minWidth || m.height < minHeight {
@@ -133,14 +169,20 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// Ignore any key other than "*" until the window is resized.
 				return m, nil
 			} else if msg.String() == "*" {
-				m.dataStore.Save()
-				return m, tea.Quit
+				return m, m.quit()
 			}
 		}
+		if m.promptKind != promptNone {
+			m.handlePromptKey(msg)
+			m.clearMessages()
+			return m, nil
+		}
 		switch msg.String() {
 		case "*":
-			m.dataStore.Save()
-			return m, tea.Quit
+			if m.currentTab == tabAddDownload && m.focusedField == 5 {
+				break // "*" is part of cron expressions
+			}
+			return m, m.quit()
 		case "shift+left":
 			m.handleTabLeft()
 		case "shift+right":
@@ -152,9 +194,10 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.currentTab == tabQueues {
 				m.handleNewOrEditQueueFormSubmit()
 			}
-		case "-":
+		case "esc": // "-" is a valid character in dates, directories and schedules
 			if m.currentTab == tabAddDownload {
 				m.focusedField = 0
+				m.updateFieldFocus()
 			}
 			if m.currentTab == tabQueues {
 				m.handleCancel()
@@ -170,6 +213,9 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.currentTab == tabQueues {
 				m.handleUpArrowForTab3()
 			}
+			if m.currentTab == tabRecurring {
+				m.handleUpArrowForTab2()
+			}
 
 		case "down":
 			if m.currentTab == tabAddDownload {
@@ -181,12 +227,15 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.currentTab == tabQueues {
 				m.handleDownArrowForTab3()
 			}
+			if m.currentTab == tabRecurring {
+				m.handleDownArrowForRecurring()
+			}
 		case "tab":
 			if m.currentTab == tabAddDownload {
 				m.updateFocusedFieldForTab1()
 			}
 			if m.currentTab == tabQueues {
-				m.focusedFieldForQueues = (m.focusedFieldForQueues + 1) % 6
+				m.focusedFieldForQueues = (m.focusedFieldForQueues + 1) % len(m.queueFormInputs())
 				m.updateFocusedFieldForTab3()
 			}
 		/*case " ":
@@ -198,14 +247,91 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.removeDownload()
 			} else if m.currentTab == tabQueues {
 				m.removeQueue()
+			} else if m.currentTab == tabRecurring {
+				m.removeRecurring()
 			}
 		case "p": // Pause/Resume selected download
 			if m.currentTab == tabDownloads {
 				m.togglePauseDownload()
+			} else if counterForForms == 0 && m.currentTab == tabQueues {
+				m.setQueueState(manager.QueuePaused)
 			}
 		case "r": // Retry selected download if failed
 			if m.currentTab == tabDownloads {
 				m.retryDownload()
+			} else if m.currentTab == tabRecurring {
+				m.runRecurringNow()
+			} else if counterForForms == 0 && m.currentTab == tabQueues {
+				m.setQueueState(manager.QueueRunning)
+			}
+		case "w": // Drain the selected queue
+			if counterForForms == 0 && m.currentTab == tabQueues {
+				m.setQueueState(manager.QueueDraining)
+			}
+		case "a": // Return the selected queue to its active hours, or set what the selected download waits for
+			if counterForForms == 0 && m.currentTab == tabQueues {
+				m.setQueueState("")
+			} else if m.currentTab == tabDownloads {
+				if download := m.selectedDownload(); download != nil {
+					m.openPrompt(promptDependencies, formatDependencies(download))
+				}
+			}
+		case "ctrl+p": // Pause or resume all queues
+			m.togglePauseAll()
+		case "b": // Limit the bandwidth of the selected download
+			if m.currentTab == tabDownloads {
+				if download := m.selectedDownload(); download != nil {
+					m.openPrompt(promptDownloadBandwidth, strconv.Itoa(download.MaxBandwidth))
+				}
+			}
+		case "g": // Limit the bandwidth of all queues together
+			if m.currentTab == tabDownloads || (counterForForms == 0 && m.currentTab == tabQueues) {
+				m.openPrompt(promptGlobalBandwidth, strconv.Itoa(m.downloadmanager.GlobalBandwidth))
+			}
+		case "c": // Limit the connections of all queues together and per host
+			if counterForForms == 0 && m.currentTab == tabQueues {
+				m.openPrompt(promptConnectionLimits, fmt.Sprintf("%d %d %d", m.downloadmanager.MaxConnections,
+					m.downloadmanager.MaxConnectionsPerHost, m.downloadmanager.IdleConnsPerHost))
+			}
+		case "t": // Set the timeouts of the requests and when a download counts as stalled
+			if counterForForms == 0 && m.currentTab == tabQueues {
+				m.openPrompt(promptTimeouts, manager.FormatTimeouts(m.downloadmanager.Timeouts))
+			}
+		case "f": // Start the selected queue when another queue is done
+			if counterForForms == 0 && m.currentTab == tabQueues {
+				if queue := m.selectedQueue(); queue != nil {
+					m.openPrompt(promptQueueDependency, strconv.Itoa(queue.DependsOnQueue))
+				}
+			}
+		case "[", "]", "{", "}": // Move the selected download up, down, to the top or to the bottom
+			if m.currentTab == tabDownloads {
+				m.moveDownload(msg.String())
+			}
+		case "m": // Move the selected download to another queue
+			if m.currentTab == tabDownloads {
+				if download := m.selectedDownload(); download != nil {
+					m.openPrompt(promptMoveDownload, strconv.Itoa(download.QueueID))
+				}
+			}
+		case "y": // Cycle the priority of the selected download
+			if m.currentTab == tabDownloads {
+				m.cyclePriority()
+			}
+		case "i": // Show or hide the details of the selected download or the history of a recurring one
+			if m.currentTab == tabDownloads || m.currentTab == tabRecurring {
+				m.showDetails = !m.showDetails
+			}
+		case "o": // Overwrite the existing file of a conflicting download
+			if m.currentTab == tabDownloads {
+				m.resolveConflict(manager.ConflictOverwrite)
+			}
+		case "k": // Keep both files of a conflicting download
+			if m.currentTab == tabDownloads {
+				m.resolveConflict(manager.ConflictRename)
+			}
+		case "s": // Skip a conflicting download if the files are identical
+			if m.currentTab == tabDownloads {
+				m.resolveConflict(manager.ConflictSkip)
 			}
 		case "n": // Press N to add a new queue
 			if counterForForms == 0 && m.currentTab == tabQueues {
@@ -262,6 +388,8 @@ func (m *Model) View() string {
 			tabName = "Downloads"
 		case tabQueues:
 			tabName = "Queues"
+		case tabRecurring:
+			tabName = "Recurring"
 		case tabHelp:
 			tabName = "Help"
 		}
@@ -279,6 +407,8 @@ func (m *Model) View() string {
 		content = m.renderDownloadListTab(tabsRow)
 	case tabQueues:
 		content = m.renderQueuesTab(tabsRow)
+	case tabRecurring:
+		content = m.renderRecurringTab(tabsRow)
 	case tabHelp:
 		content = m.renderHelpPage(tabsRow)
 	}
@@ -326,30 +456,44 @@ func (m *Model) renderHelpPage(tabsRow string) string {
 	helpContent += headerStyle.Render("Add Download Tab:") + "\n"
 	helpContent += textStyle.Render("  Enter: Submits the new download form.") + "\n"
 	helpContent += textStyle.Render("  Up/Down Arrows: Navigate through the queue list.") + "\n"
-	helpContent += textStyle.Render("  Tab: Cycles focus among URL, queue selection, and output file name.") + "\n"
-	helpContent += textStyle.Render("  \"-\": Resets focus back to the URL input field.") + "\n"
+	helpContent += textStyle.Render("  Tab: Cycles focus among URL, queue selection, output file name and the schedule fields.") + "\n"
+	helpContent += textStyle.Render("  Repeat: A cron expression such as 0 2 * * * repeats the download, the name is then a template.") + "\n"
+	helpContent += textStyle.Render("  Esc: Resets focus back to the URL input field.") + "\n"
 
 	// Downloads Tab section.
 	helpContent += headerStyle.Render("Downloads Tab:") + "\n"
 	helpContent += textStyle.Render("  Up/Down Arrows: Navigate through the list of downloads.") + "\n"
 	helpContent += textStyle.Render("  D: Removes the selected download.") + "\n"
-	helpContent += textStyle.Render("  P: Pauses or resumes the selected download.") + "\n"
-	helpContent += textStyle.Render("  R: Retries the selected download if it has failed.") + "\n"
+	helpContent += textStyle.Render("  P: Pauses or resumes the selected download, resuming after its stop time clears it.") + "\n"
+	helpContent += textStyle.Render("  R: Retries the selected download if it has failed, only its failed parts when the others are done.") + "\n"
+	helpContent += textStyle.Render("  B: Sets the bandwidth limit of the selected download. G: Sets the global one for all queues.") + "\n"
+	helpContent += textStyle.Render("  I: Shows or hides the details of the selected download.") + "\n"
+	helpContent += textStyle.Render("  M: Moves the selected pending, paused or failed download to another queue. A: Sets the downloads it starts after.") + "\n"
+	helpContent += textStyle.Render("  [ / ]: Moves the selected download up/down, { / }: to the top/bottom. Y: Cycles its priority.") + "\n"
+	helpContent += textStyle.Render("  O/K/S: Overwrite, keep both or skip when the file already exists (conflict).") + "\n"
 
 	// Queues Tab section.
 	helpContent += headerStyle.Render("Queues Tab:") + "\n"
 	helpContent += textStyle.Render("  Up/Down Arrows: Navigate through the list of queues.") + "\n"
 	helpContent += textStyle.Render("  N: Opens the form for adding a new queue.") + "\n"
-	helpContent += textStyle.Render("  E: Opens the form for editing the currently selected queue.") + "\n"
-	helpContent += textStyle.Render("  Enter: Submits the queue form (new or edit).") + "\n"
-	helpContent += textStyle.Render("  Tab: Cycles through the fields in the queue form.") + "\n"
-	helpContent += textStyle.Render("  \"-\": Cancels the current queue form and resets the fields.") + "\n"
-	helpContent += textStyle.Render("  D: Removes the selected queue.") + "\n"
+	helpContent += textStyle.Render("  E: Opens the form for editing the currently selected queue. F: Starts it only when another queue is done.") + "\n"
+	helpContent += textStyle.Render("  Enter: Submits the queue form (new or edit). Tab: Cycles through its fields.") + "\n"
+	helpContent += textStyle.Render("  Esc: Cancels the current queue form and resets the fields.") + "\n"
+	helpContent += textStyle.Render("  D: Removes the selected queue. G: Sets the global bandwidth limit. C: Sets the connection limits. T: The timeouts.") + "\n"
+	helpContent += textStyle.Render("  P: Pauses the queue, R: Runs it at any hour, W: Drains it, A: Returns it to its active hours.") + "\n"
+	helpContent += textStyle.Render("  Current BW shows the bandwidth in effect now and its schedule tier (t1, t2, ...).") + "\n"
+
+	// Recurring Tab section.
+	helpContent += headerStyle.Render("Recurring Tab:") + "\n"
+	helpContent += textStyle.Render("  R: Runs the selected recurring download now. D: Removes it. I: Shows its history.") + "\n"
 
 	// Global keys section.
 	helpContent += headerStyle.Render("Global Keys:") + "\n"
-	helpContent += globalTextStyle.Render("  *: Exit help mode when active.") + "\n"
+	helpContent += globalTextStyle.Render("  *: Exit help mode when active, typed as text in the Repeat field.") + "\n"
 	helpContent += globalTextStyle.Render("  shift+right/left: Navigate through the tabs") + "\n"
+	helpContent += globalTextStyle.Render("  ctrl+p: Pauses all queues, or resumes those it paused when all are paused.") + "\n"
+	helpContent += globalTextStyle.Render("  Esc: Cancels an open prompt.") + "\n"
+	helpContent += globalTextStyle.Render("  The tightest of the global, queue and download bandwidth limits is applied.") + "\n"
 
 	return helpContent
 }
@@ -395,8 +539,11 @@ func (m *Model) renderQueuesTab(tabsRow string) string {
 	for rowIndex, row := range m.queuesTable.Rows() {
 		rowStr := ""
 		for colIndex, cell := range row {
-			if columns[colIndex].Title == "SaveDir" && len(cell) > 40 {
-				cell = cell[:40] + "..."
+			if columns[colIndex].Title == "SaveDir" && len(cell) > 27 {
+				cell = cell[:27] + "..."
+			}
+			if columns[colIndex].Title == "Active Hours" && len(cell) > 22 {
+				cell = cell[:19] + "..."
 			}
 			if columns[colIndex].Title == "Max Bandwidth" {
 				if cell == "0" {
@@ -440,6 +587,8 @@ func (m *Model) renderQueuesTab(tabsRow string) string {
 	navigationStyle := lipgloss.NewStyle().
 		Italic(true).
 		Foreground(lipgloss.Color("#F39C12"))
+	content += fmt.Sprintf("\n\n%s", m.globalBandwidthInfo())
+	content += m.renderPrompt()
 	content += fmt.Sprintf("\n\n%s", navigationStyle.Render("	  Use shift+right/left to navigate through the tabs."))
 	return content
 }
@@ -493,6 +642,29 @@ func (m *Model) renderAddDownloadTab(tabsRow string) string {
 		outnameCursor+m.outputFileName.View(),
 	)
 
+	// Schedule fields: a one-shot start and stop time, or a cron expression to repeat the download
+	content += greenTitleStyle.Render("Schedule (optional):") + "\n"
+	for i, field := range []struct {
+		label string
+		input textinput.Model
+	}{
+		{"Start At", m.startAtInput},
+		{"Stop At", m.stopAtInput},
+		{"Repeat", m.repeatInput},
+		{"Keep Last", m.keepLastInput},
+	} {
+		cursor := cursorStyle.Render("  ")
+		if m.focusedField == i+3 {
+			cursor = cursorStyle.Render("> ")
+		}
+		content += fmt.Sprintf("%s%-11s%s\n", cursor, field.label+":", field.input.View())
+	}
+	onConflictCursor := cursorStyle.Render("  ")
+	if m.focusedField == 7 {
+		onConflictCursor = cursorStyle.Render("> ")
+	}
+	content += fmt.Sprintf("\n%s\n%s\n", greenTitleStyle.Render("If the File Exists (optional):"), onConflictCursor+m.onConflictInput.View())
+
 	// Display error message (if any)
 	if m.errorMessage != "" {
 		content += fmt.Sprintf("\n\n%s", redErrorStyle.Render(m.errorMessage))
@@ -548,8 +720,14 @@ func (m *Model) renderDownloadListTab(tabsRow string) string {
 	for rowIndex, row := range m.downloadsTable.Rows() {
 		rowStr := ""
 		for colIndex, cell := range row {
-			if columns[colIndex].Title == "URL" && len(cell) > 40 {
-				cell = cell[:40] + "..."
+			if columns[colIndex].Title == "URL" && len(cell) > 30 {
+				cell = cell[:30] + "..."
+			}
+			if columns[colIndex].Title == "Error" && len(cell) > 13 {
+				cell = cell[:13] + "..."
+			}
+			if columns[colIndex].Title == "Saved As" && len(cell) > 16 {
+				cell = cell[:16] + "..."
 			}
 			// Alternate between lemon yellow (odd) and sky blue (even)
 			bgColor := "#87CEEB" // Sky blue for even columns
@@ -585,6 +763,15 @@ func (m *Model) renderDownloadListTab(tabsRow string) string {
 	if m.errorMessage != "" {
 		content += fmt.Sprintf("\n\n%s", redErrorStyle.Render(m.errorMessage))
 	}
+	if rows := m.downloadsTable.Rows(); m.selectedRow >= 0 && m.selectedRow < len(rows) && rows[m.selectedRow][3] == "conflict" {
+		content += fmt.Sprintf("\n\n%s", redErrorStyle.Render(
+			"The file already exists: press O to overwrite, K to keep both or S to skip if identical.",
+		))
+	}
+	if m.showDetails {
+		content += fmt.Sprintf("\n\n%s", m.renderDownloadDetails())
+	}
+	content += m.renderPrompt()
 
 	// Apply the navigation style (italic and #F39C12 color)
 	navigationStyle := lipgloss.NewStyle().
@@ -596,6 +783,143 @@ func (m *Model) renderDownloadListTab(tabsRow string) string {
 	return content
 }
 
+func (m *Model) renderDownloadDetails() string {
+	download := m.selectedDownload()
+	if download == nil {
+		return ""
+	}
+	download = m.downloadmanager.Snapshot(download)
+	labelStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#87CEEB"))
+	details := []struct{ label, value string }{
+		{"URL", download.URL},
+		{"Status", download.GetStatus()},
+		{"Saved To", savedAs(download)},
+		{"Size", "-"},
+		{"Completed At", "-"},
+		{"Average Speed", "-"},
+		{"Last Modified", "-"},
+		{"Bandwidth", "Unlimited"},
+		{"Priority", download.GetPriority()},
+		{"Start At", "-"},
+		{"Stop At", "-"},
+		{"Recurring", "-"},
+		{"Depends On", "-"},
+		{"Parts", "-"},
+		{"Error", "-"},
+	}
+	if download.OutputPath != "" {
+		details[2].value = download.OutputPath
+	}
+	if download.FinalSize > 0 {
+		details[3].value = formatBytes(download.FinalSize)
+	} else {
+		details[3].value = "unknown"
+		if download.TotalSize > 0 {
+			details[3].value = formatBytes(download.TotalSize)
+		}
+		if download.Status != "initializing" {
+			details[3].value += ", " + formatBytes(received(download)) + " received"
+		}
+		if download.Status == "downloading" {
+			details[3].value += fmt.Sprintf(" in %s at %d KB/s", formatCountdown(time.Since(download.Temps.StartTime)), download.GetSpeed())
+		}
+	}
+	if !download.CompletedAt.IsZero() {
+		details[4].value = download.CompletedAt.Format("2006-01-02 15:04:05")
+		details[5].value = formatBytes(download.AverageSpeed) + "/s"
+	}
+	if download.LastModified != "" {
+		details[6].value = download.LastModified
+	}
+	if download.MaxBandwidth > 0 {
+		details[7].value = strconv.Itoa(download.MaxBandwidth) + " KB/s"
+	}
+	if !download.StartAt.IsZero() {
+		details[9].value = download.StartAt.Local().Format(dateTimeLayout)
+	}
+	if !download.StopAt.IsZero() {
+		details[10].value = download.StopAt.Local().Format(dateTimeLayout)
+	}
+	if recurring := m.dataStore.Recurrings[strconv.Itoa(download.RecurringID)]; recurring != nil {
+		details[11].value = fmt.Sprintf("%d (%s)", recurring.ID, recurring.Cron)
+	}
+	if len(download.DependsOn) > 0 {
+		details[12].value = fmt.Sprintf("%s (%s)", joinIDs(download.DependsOn, ", "), download.GetDependencyPolicy())
+		if waiting := m.downloadmanager.WaitingFor(download); len(waiting) > 0 {
+			details[12].value += ", waiting for " + joinIDs(waiting, ", ")
+		}
+		if missing := m.downloadmanager.MissingDependencies(download); len(missing) > 0 {
+			details[12].value += ", not found: " + joinIDs(missing, ", ")
+		}
+	}
+
+	if len(download.PartDownloaders) > 0 {
+		details[13].value = strconv.Itoa(len(download.PartDownloaders))
+		for _, part := range download.PartDownloaders {
+			if part.IsFailed {
+				details[13].value += fmt.Sprintf(", part %d failed after %d retries", part.Index+1, part.Retries)
+			}
+		}
+	}
+	if download.LastError != "" {
+		details[14].value = fmt.Sprintf("%s (%s)", download.LastError, download.ErrorKind)
+	}
+
+	content := greenTitleStyle.Render(fmt.Sprintf("Download %d details:", download.ID))
+	for _, detail := range details {
+		content += fmt.Sprintf("\n  %s %s", labelStyle.Render(fmt.Sprintf("%-14s", detail.label+":")), detail.value)
+	}
+	return content
+}
+
+func (m *Model) globalBandwidthInfo() string {
+	bandwidth := "Unlimited"
+	if m.downloadmanager.GlobalBandwidth > 0 {
+		bandwidth = strconv.Itoa(m.downloadmanager.GlobalBandwidth) + " KB/s"
+	}
+	return greenTitleStyle.Render("Global Bandwidth: ") + bandwidth + "    " + m.connectionLimitsInfo()
+}
+
+func (m *Model) connectionLimitsInfo() string {
+	limit := func(n int) string {
+		if n == 0 {
+			return "unlimited"
+		}
+		return strconv.Itoa(n)
+	}
+	return greenTitleStyle.Render("Connections: ") + fmt.Sprintf("%d open, %s in total, %s per host, %d idle kept per host",
+		m.downloadmanager.OpenConnections(), limit(m.downloadmanager.MaxConnections), limit(m.downloadmanager.MaxConnectionsPerHost),
+		m.downloadmanager.IdleConnsPerHost)
+}
+
+func (m *Model) selectedDownload() *manager.Download {
+	rows := m.downloadsTable.Rows()
+	if m.selectedRow < 0 || m.selectedRow >= len(rows) {
+		return nil
+	}
+	return m.dataStore.Downloads[rows[m.selectedRow][0]]
+}
+
+func (m *Model) selectedQueue() *manager.Queue {
+	rows := m.queuesTable.Rows()
+	if m.selectedRow < 0 || m.selectedRow >= len(rows) {
+		return nil
+	}
+	return m.dataStore.Queues[rows[m.selectedRow][0]]
+}
+
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1024*1024*1024:
+		return fmt.Sprintf("%.2f GB", float64(size)/(1024*1024*1024))
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.2f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
 func (m *Model) renderQueueForm() string {
 	var content string
 	navigationStyle := lipgloss.NewStyle().
@@ -611,7 +935,7 @@ func (m *Model) renderQueueForm() string {
 
 	// Display the fields for Save Directory, Max Concurrent, Max Bandwidth and Max Retries Per Download
 	content += fmt.Sprintf(
-		"%s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n\n",
+		"%s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n\n",
 		"",
 		italicYellowStyle.Render("Save Directory"),
 		m.saveDirInput.View(),
@@ -621,18 +945,38 @@ func (m *Model) renderQueueForm() string {
 		m.maxBandwidthInput.View(),
 		italicYellowStyle.Render("Max Retries per download"),
 		m.maxRetriesPerDLInput.View(),
+		italicYellowStyle.Render("Retry Backoff"),
+		m.retryPolicyInput.View(),
 		italicYellowStyle.Render("Active Start Time"),
 		m.activeStartTimeInput.View(),
 		italicYellowStyle.Render("Active End Time"),
 		m.activeEndTimeInput.View(),
+		italicYellowStyle.Render("Conflict Policy"),
+		m.conflictPolicyInput.View(),
+		italicYellowStyle.Render("Min Free Space"),
+		m.minFreeSpaceInput.View(),
+		italicYellowStyle.Render("Bandwidth Schedule"),
+		m.bwScheduleInput.View(),
+		italicYellowStyle.Render("Weekly Schedule"),
+		m.weeklyScheduleInput.View(),
+		italicYellowStyle.Render("Time Zone"),
+		m.timeZoneInput.View(),
+		italicYellowStyle.Render("Exception Dates"),
+		m.exceptionDatesInput.View(),
 	)
 
 	// Add instructions with the same style
-	content += fmt.Sprintf("\n%s\n", italicYellowStyle.Render("Press Enter to submit, or \"-\" to cancel."))
+	content += fmt.Sprintf("\n%s\n", italicYellowStyle.Render("Press Enter to submit, or Esc to cancel."))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Note:"))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Time must be in HH:MM format."))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Max Concurrent must be an integer from 1 to 200."))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Max Bandwidth must be an integer in KB/S. 0 makes no limit."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Retry Backoff is the first delay, its growth, the longest delay and a random part, e.g. \"1s x2 1m 20%\"."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Conflict Policy is one of rename, overwrite, skip, resume or ask. Default is rename."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Min Free Space in MB is kept free on the disks a download is saved to, or it waits paused."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Bandwidth Schedule is optional, e.g. \"mon-fri 09:00-18:00 200; sat,sun 00:00-23:59 0\"."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Weekly Schedule is optional and replaces the active times, e.g. \"mon-fri 09:00-17:00; sat 22:00-06:00\"."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Time Zone is an IANA name like Asia/Tehran, Exception Dates are YYYY-MM-DD separated by commas."))
 
 	return content
 }
@@ -655,7 +999,7 @@ func (m *Model) renderQueueFormForEdit() string {
 
 	// Display the fields for Save Directory, Max Concurrent, Max Bandwidth  Max Retries Per Download
 	content += fmt.Sprintf(
-		"%s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n\n",
+		"%s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n%s: %s\n\n",
 		"",
 		italicYellowStyle.Render("Save Directory"),
 		m.saveDirInput.View(),
@@ -665,18 +1009,38 @@ func (m *Model) renderQueueFormForEdit() string {
 		m.maxBandwidthInput.View(),
 		italicYellowStyle.Render("Max Retries per download"),
 		m.maxRetriesPerDLInput.View(),
+		italicYellowStyle.Render("Retry Backoff"),
+		m.retryPolicyInput.View(),
 		italicYellowStyle.Render("Active Start Time"),
 		m.activeStartTimeInput.View(),
 		italicYellowStyle.Render("Active End Time"),
 		m.activeEndTimeInput.View(),
+		italicYellowStyle.Render("Conflict Policy"),
+		m.conflictPolicyInput.View(),
+		italicYellowStyle.Render("Min Free Space"),
+		m.minFreeSpaceInput.View(),
+		italicYellowStyle.Render("Bandwidth Schedule"),
+		m.bwScheduleInput.View(),
+		italicYellowStyle.Render("Weekly Schedule"),
+		m.weeklyScheduleInput.View(),
+		italicYellowStyle.Render("Time Zone"),
+		m.timeZoneInput.View(),
+		italicYellowStyle.Render("Exception Dates"),
+		m.exceptionDatesInput.View(),
 	)
 
 	// Add instructions with the same styling
-	content += fmt.Sprintf("\n%s\n", navigationStyle.Render("Press Enter to submit, or \"-\" to cancel."))
+	content += fmt.Sprintf("\n%s\n", navigationStyle.Render("Press Enter to submit, or Esc to cancel."))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Note:"))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Time must be in HH:MM format."))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Max Concurrent must be an integer from 1 to 200."))
 	content += fmt.Sprintf("%s\n", navigationStyle.Render("Max Bandwidth must be an integer in KB/S. 0 makes no limit."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Retry Backoff is the first delay, its growth, the longest delay and a random part, e.g. \"1s x2 1m 20%\"."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Conflict Policy is one of rename, overwrite, skip, resume or ask. Default is rename."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Min Free Space in MB is kept free on the disks a download is saved to, or it waits paused."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Bandwidth Schedule is optional, e.g. \"mon-fri 09:00-18:00 200; sat,sun 00:00-23:59 0\"."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Weekly Schedule is optional and replaces the active times, e.g. \"mon-fri 09:00-17:00; sat 22:00-06:00\"."))
+	content += fmt.Sprintf("%s\n", navigationStyle.Render("Time Zone is an IANA name like Asia/Tehran, Exception Dates are YYYY-MM-DD separated by commas."))
 
 	return content
 }
@@ -697,15 +1061,42 @@ func NewModel() *Model {
 	MaxParts := 10 // Maximum number of parts for one download
 	PartSize := 10 // create new part downloader per each PartSize mb
 	downloadmanager := manager.NewManager(MaxParts, PartSize)
+	downloadmanager.SetGlobalBandwidth(dataStore.Settings.GlobalBandwidth)
+	downloadmanager.SetConnectionLimits(dataStore.Settings.MaxConnections, dataStore.Settings.MaxConnectionsPerHost)
+	downloadmanager.SetIdleConnections(dataStore.Settings.IdleConnsPerHost)
+	if dataStore.Settings.Timeouts != nil {
+		downloadmanager.SetTimeouts(*dataStore.Settings.Timeouts)
+	}
+	downloadmanager.UseStore(dataStore)
 
 	ti := textinput.New()
 	ti.Placeholder = "Enter Download URL..."
 	ti.Focus()
 
 	outputFileName := textinput.New()
-	outputFileName.Placeholder = "Optional output file name"
+	outputFileName.Placeholder = "Optional output file name, detected from the server if empty"
 	outputFileName.Blur()
 
+	startAtInput := textinput.New()
+	startAtInput.Placeholder = "YYYY-MM-DD HH:MM, starts as soon as the queue allows if empty"
+	startAtInput.Width = 70
+
+	stopAtInput := textinput.New()
+	stopAtInput.Placeholder = "YYYY-MM-DD HH:MM, pauses the download at this time"
+	stopAtInput.Width = 70
+
+	repeatInput := textinput.New()
+	repeatInput.Placeholder = "Cron such as 0 2 * * * or @daily, the name becomes a template of {name} {ext} {date} {time}"
+	repeatInput.Width = 70
+
+	keepLastInput := textinput.New()
+	keepLastInput.Placeholder = "Versions of a repeated download to keep, 0 keeps all"
+	keepLastInput.Width = 70
+
+	onConflictInput := textinput.New()
+	onConflictInput.Placeholder = "rename, overwrite, skip, resume or ask, the queue's policy if empty"
+	onConflictInput.Width = 70
+
 	keys := make([]string, 0, len(dataStore.Queues))
 	for key := range dataStore.Queues {
 		keys = append(keys, key)
@@ -716,20 +1107,11 @@ func NewModel() *Model {
 	queueRows := []table.Row{}
 	for _, key := range keys {
 		row := dataStore.Queues[key]
-		maxBandwidth := row.MaxBandwidth
 		downloadmanager.AddQueue(row)
 		if row.ID > maxQueueID {
 			maxQueueID = row.ID
 		}
-		queueRows = append(queueRows, table.Row{
-			strconv.Itoa(row.ID),
-			row.SaveDir,
-			strconv.Itoa(row.MaxConcurrentDownloads),
-			strconv.Itoa(maxBandwidth),
-			strconv.Itoa(row.MaxRetries),
-			row.ActiveStartTime,
-			row.ActiveEndTime,
-		})
+		queueRows = append(queueRows, queueToRow(row, downloadmanager.Clock.Now()))
 	}
 	queuesTable := table.New(
 		table.WithColumns(queueColumns), // Specify columns with WithColumns
@@ -743,7 +1125,7 @@ func NewModel() *Model {
 	sort.Sort(ByDescending(keys))
 	maxDownloadID := 0
 
-	downloadRows := []table.Row{}
+	var loaded []*manager.Download
 	for _, key := range keys {
 		row := dataStore.Downloads[key]
 		if row.ID > maxDownloadID {
@@ -756,16 +1138,22 @@ func NewModel() *Model {
 		row.Queue = dataStore.Queues[strconv.Itoa(row.QueueID)]
 
 		downloadmanager.AddDownload(row)
-		downloadRows = append(downloadRows, table.Row{
-			strconv.Itoa(row.ID),
-			strconv.Itoa(row.QueueID),
-			row.URL,
-			row.Status,
-			"N/A",
-			"N/A",
-			"0",
-		})
+		loaded = append(loaded, row)
+	}
+	downloadRows := []table.Row{}
+	positions := downloadmanager.Positions()
+	for _, download := range loaded {
+		downloadRows = append(downloadRows, downloadToRow(downloadmanager, download, positions))
+	}
+	maxRecurringID := 0
+	for _, recurring := range dataStore.Recurrings {
+		if recurring.ID > maxRecurringID {
+			maxRecurringID = recurring.ID
+		}
+		recurring.Queue = dataStore.Queues[strconv.Itoa(recurring.QueueID)]
+		downloadmanager.AddRecurring(recurring)
 	}
+
 	// Initialize the Downloads table using WithColumns option
 	downloadsTable := table.New(
 		table.WithColumns(downloadColumns), // Specify columns with WithColumns
@@ -783,16 +1171,40 @@ func NewModel() *Model {
 
 	maxRetriesPerDLInput := textinput.New()
 	maxRetriesPerDLInput.Placeholder = "Enter Max Retries Per Download. "
+	retryPolicyInput := textinput.New()
+	retryPolicyInput.Placeholder = "Default is 1s x2 1m 20%"
 
 	activeStartTimeInput := textinput.New()
 	activeStartTimeInput.Placeholder = "Default is 00:00"
 	activeEndTimeInput := textinput.New()
 	activeEndTimeInput.Placeholder = "Default is 23:59"
+	conflictPolicyInput := textinput.New()
+	conflictPolicyInput.Placeholder = "Default is rename"
+	minFreeSpaceInput := textinput.New()
+	minFreeSpaceInput.Placeholder = "Default is 0 MB"
+	bwScheduleInput := textinput.New()
+	bwScheduleInput.Placeholder = "Optional, [days] HH:MM-HH:MM KB/s; ..."
+	bwScheduleInput.Width = 60
+	weeklyScheduleInput := textinput.New()
+	weeklyScheduleInput.Placeholder = "Optional, [days] HH:MM-HH:MM; ..."
+	weeklyScheduleInput.Width = 60
+	timeZoneInput := textinput.New()
+	timeZoneInput.Placeholder = "Default is local time"
+	exceptionDatesInput := textinput.New()
+	exceptionDatesInput.Placeholder = "Optional, YYYY-MM-DD, ..."
+	exceptionDatesInput.Width = 60
+
+	promptInput := textinput.New()
 
 	return &Model{
 		currentTab:            tabDownloads,
 		inputURL:              ti,
 		outputFileName:        outputFileName,
+		startAtInput:          startAtInput,
+		stopAtInput:           stopAtInput,
+		repeatInput:           repeatInput,
+		keepLastInput:         keepLastInput,
+		onConflictInput:       onConflictInput,
 		selectedQueueRowIndex: 0,
 		focusedField:          0,
 		confirmationMessage:   "",
@@ -805,38 +1217,54 @@ func NewModel() *Model {
 		maxConcurrentInput:    maxConcurrentInput,
 		maxBandwidthInput:     maxBandwidthInput,
 		maxRetriesPerDLInput:  maxRetriesPerDLInput,
+		retryPolicyInput:      retryPolicyInput,
 		activeStartTimeInput:  activeStartTimeInput,
 		activeEndTimeInput:    activeEndTimeInput,
+		conflictPolicyInput:   conflictPolicyInput,
+		minFreeSpaceInput:     minFreeSpaceInput,
+		bwScheduleInput:       bwScheduleInput,
+		weeklyScheduleInput:   weeklyScheduleInput,
+		timeZoneInput:         timeZoneInput,
+		exceptionDatesInput:   exceptionDatesInput,
+		promptInput:           promptInput,
 		focusedFieldForQueues: 0, // Focus on Save Directory initially
 		dataStore:             dataStore,
 		maxQueueID:            maxQueueID,
 		maxDownloadID:         maxDownloadID,
+		maxRecurringID:        maxRecurringID,
 		downloadmanager:       downloadmanager,
 	}
 }
 
 func (m *Model) updateDownloadTable() {
 	var downloadRows []table.Row
+	finished := false
+	positions := m.downloadmanager.Positions()
 
 	for _, row := range m.downloadsTable.Rows() {
 		download := m.dataStore.Downloads[row[0]]
-		if download == nil || download.IsRemoved || download.Queue == nil {
+		if download == nil {
 			continue
 		}
-		row[3] = download.GetStatus()
-
-		if download.IsPartial {
-			switch download.Status {
-			case "finished":
-				row[4] = "100%"
-			case "initializing":
-				row[4] = "N/A"
-			default:
-				row[4] = strconv.Itoa(download.GetProgress()) + "%"
-
-			}
-		} else {
-			row[4] = "?"
+		download = m.downloadmanager.Snapshot(download)
+		if download.IsRemoved || download.Queue == nil {
+			continue
+		}
+		if row[3] != "finished" && download.GetStatus() == "finished" {
+			finished = true
+		}
+		row[1] = strconv.Itoa(download.QueueID)
+		row[3] = downloadStatus(m.downloadmanager, download)
+
+		switch {
+		case download.Status == "finished":
+			row[4] = "100%"
+		case download.Status == "initializing":
+			row[4] = "N/A"
+		case download.TotalSize > 0:
+			row[4] = strconv.Itoa(download.GetProgress()) + "%"
+		default: // the server did not tell the size
+			row[4] = formatBytes(received(download))
 		}
 
 		if download.GetStatus() != "downloading" {
@@ -850,9 +1278,161 @@ func (m *Model) updateDownloadTable() {
 			}
 
 		}
-		row[6] = strconv.Itoa(download.Temps.Retries)
+		row[6] = strconv.Itoa(download.GetRetries())
+		row[7] = savedAs(download)
+		row[8] = priorityCell(download, positions)
+		row[9] = download.LastError
 
 		downloadRows = append(downloadRows, row)
 	}
 	m.downloadsTable.SetRows(downloadRows)
+	if finished {
+		// persist the completion details right away
+		m.dataStore.Save()
+	}
+}
+
+// queueToRow describes the queue with the bandwidth in effect at now, which
+// is read from the manager's clock that applies the tiers.
+func queueToRow(queue *manager.Queue, now time.Time) table.Row {
+	conflictPolicy := queue.ConflictPolicy
+	if conflictPolicy == "" {
+		conflictPolicy = manager.ConflictRename
+	}
+	currentBandwidth, tier := queue.CurrentBandwidth(now)
+	currentBW := "Unlimited"
+	if currentBandwidth > 0 {
+		currentBW = strconv.Itoa(currentBandwidth)
+	}
+	if tier >= 0 {
+		currentBW += fmt.Sprintf(" (t%d)", tier+1)
+	}
+	return table.Row{
+		strconv.Itoa(queue.ID),
+		queue.SaveDir,
+		strconv.Itoa(queue.MaxConcurrentDownloads),
+		strconv.Itoa(queue.MaxBandwidth),
+		strconv.Itoa(queue.MaxRetries),
+		activeHours(queue),
+		conflictPolicy,
+		currentBW,
+	}
+}
+
+// activeHours describes when the queue downloads, by its schedule or active times
+func activeHours(queue *manager.Queue) string {
+	after := ""
+	if queue.DependsOnQueue != 0 {
+		after = fmt.Sprintf("after Q%d ", queue.DependsOnQueue)
+	}
+	if queue.State != "" {
+		return after + queue.State + " (manual)"
+	}
+	hours := after + queue.ActiveStartTime + "-" + queue.ActiveEndTime
+	if queue.Schedule == nil {
+		return hours
+	}
+	if windows := manager.FormatScheduleWindows(queue.Schedule); windows != "" {
+		hours = after + windows
+	}
+	if queue.Schedule.TimeZone != "" {
+		hours += " " + queue.Schedule.TimeZone
+	}
+	return hours
+}
+
+func (m *Model) updateQueueTable() {
+	var queueRows []table.Row
+	for _, row := range m.queuesTable.Rows() {
+		if queue := m.dataStore.Queues[row[0]]; queue != nil {
+			queueRows = append(queueRows, queueToRow(m.downloadmanager.QueueSnapshot(queue), m.downloadmanager.Clock.Now()))
+		}
+	}
+	m.queuesTable.SetRows(queueRows)
+}
+
+func downloadToRow(dm *manager.DownloadManager, download *manager.Download, positions map[int]int) table.Row {
+	download = dm.Snapshot(download)
+	return table.Row{
+		strconv.Itoa(download.ID),
+		strconv.Itoa(download.QueueID),
+		download.URL,
+		downloadStatus(dm, download),
+		"N/A",
+		"N/A",
+		"0",
+		savedAs(download),
+		priorityCell(download, positions),
+		download.LastError,
+	}
+}
+
+// priorityCell shows the priority and the place in the queue, as "high #2", from the positions of Positions
+func priorityCell(download *manager.Download, positions map[int]int) string {
+	if position := positions[download.ID]; position > 0 {
+		return fmt.Sprintf("%s #%d", download.GetPriority(), position)
+	}
+	return download.GetPriority()
+}
+
+// downloadStatus returns the status, a countdown for a download scheduled to
+// start later, or what a pending download waits for, as "after 3, 4" or "after Q1"
+func downloadStatus(dm *manager.DownloadManager, download *manager.Download) string {
+	if download.Status != "pending" {
+		return download.Status
+	}
+	if download.IsWaitingToStart(time.Now()) {
+		return "in " + formatCountdown(time.Until(download.StartAt))
+	}
+	if waiting := dm.WaitingFor(download); len(waiting) > 0 {
+		return "after " + joinIDs(waiting, ", ")
+	}
+	if download.Queue != nil && dm.IsWaitingForQueue(download.Queue) {
+		return fmt.Sprintf("after Q%d", download.Queue.DependsOnQueue)
+	}
+	return download.Status
+}
+
+func joinIDs(ids []int, separator string) string {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.Itoa(id)
+	}
+	return strings.Join(values, separator)
+}
+
+// formatDependencies returns the dependencies of a download as they are typed in the prompt, as "3 4 block"
+func formatDependencies(download *manager.Download) string {
+	if len(download.DependsOn) == 0 {
+		return ""
+	}
+	return joinIDs(download.DependsOn, " ") + " " + download.GetDependencyPolicy()
+}
+
+// formatCountdown formats a duration as 2d03h, 1h02m or 4m05s to fit the status column
+func formatCountdown(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd%02dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", d/time.Hour, d%time.Hour/time.Minute)
+	}
+	return fmt.Sprintf("%dm%02ds", d/time.Minute, d%time.Minute/time.Second)
+}
+
+// received returns the bytes of the download received so far
+func received(download *manager.Download) int64 {
+	if download.Temps == nil {
+		return 0
+	}
+	return download.Temps.TotalDownloaded
+}
+
+// savedAs returns the name the file was saved under, or the planned one
+func savedAs(download *manager.Download) string {
+	if download.OutputPath != "" {
+		return filepath.Base(download.OutputPath)
+	}
+	return download.OutputFile
 }